@@ -0,0 +1,48 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lib/pq/pqerror"
+)
+
+// acquireBindingLock takes a transaction-scoped advisory lock keyed on the database and data owner role, so that
+// binding operations are serialized across every provider process that manages them. The lock is released when
+// the transaction commits or rolls back. The wait is bounded by the provider lock_timeout, or by the deadline of
+// ctx if it comes first, so that it always ends with a diagnostic about the other binding operations.
+func acquireBindingLock(ctx context.Context, tx *sql.Tx, cf connectionFactory) error {
+	defer traceCall(ctx, "acquireBindingLock")()
+
+	lockTimeout := cf.lockTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := deadlineLockTimeout(time.Until(deadline)); lockTimeout == 0 || remaining < lockTimeout {
+			lockTimeout = remaining
+		}
+	}
+
+	var previousLockTimeout string
+	if err := tx.QueryRowContext(ctx, "SELECT current_setting('lock_timeout')").Scan(&previousLockTimeout); err != nil {
+		return fmt.Errorf("reading lock timeout: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL lock_timeout = %d", lockTimeout.Milliseconds())); err != nil {
+		return fmt.Errorf("setting lock timeout: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))", cf.database, cf.dataOwnerRole); err != nil {
+		if pq.As(err, pqerror.LockNotAvailable) != nil {
+			return fmt.Errorf("timed out after %s waiting for other binding operations on database %q to finish: %w", lockTimeout.Round(time.Millisecond), cf.database, err)
+		}
+		return fmt.Errorf("acquiring binding lock: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT set_config('lock_timeout', $1, true)", previousLockTimeout); err != nil {
+		return fmt.Errorf("restoring lock timeout: %w", err)
+	}
+
+	return nil
+}
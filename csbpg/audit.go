@@ -0,0 +1,141 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/lib/pq"
+)
+
+const (
+	auditTable = "csbpg_audit_log"
+
+	auditOperationCreate          = "create"
+	auditOperationDelete          = "delete"
+	auditOperationRepair          = "repair"
+	auditOperationUpdatePassword  = "update_password"
+	auditOperationRevokeLogin     = "revoke_login"
+	auditOperationCleanUpDatabase = "clean_up_database"
+
+	auditOutcomeSuccess = "success"
+	auditOutcomeFailure = "failure"
+
+	auditOwnTransactionTimeout = 10 * time.Second
+)
+
+// auditTrail records the statements that a binding operation runs, so that they can be written to the audit table
+// of the provider's audit schema. Only the statements of the last attempt of a retried transaction are kept.
+type auditTrail struct {
+	cf         connectionFactory
+	operation  string
+	username   string
+	statements []string
+}
+
+func newAuditTrail(cf connectionFactory, operation, username string) *auditTrail {
+	return &auditTrail{cf: cf, operation: operation, username: username}
+}
+
+// wrap returns a transaction that records the statements run through it
+func (a *auditTrail) wrap(tx *sql.Tx) transaction {
+	a.statements = nil
+	return &auditedTransaction{Tx: tx, trail: a}
+}
+
+// recordSuccess writes the operation to the audit table in the transaction that ran it, so that it is only recorded
+// when it is committed. It does nothing unless the provider has an audit schema.
+func (a *auditTrail) recordSuccess(ctx context.Context, tx *sql.Tx) error {
+	if a.cf.auditSchema == "" {
+		return nil
+	}
+
+	if err := a.record(ctx, tx, auditOutcomeSuccess, nil); err != nil {
+		return fmt.Errorf("recording %s of binding user %q in audit log: %w", a.operation, a.username, err)
+	}
+	return nil
+}
+
+// recordFailure writes a failed operation to the audit table. The transaction of the operation has been rolled back,
+// so this is done in a transaction of its own, even if the operation failed because its context was done.
+func (a *auditTrail) recordFailure(ctx context.Context, cause error) {
+	a.recordInOwnTransaction(ctx, auditOutcomeFailure, cause)
+}
+
+// recordSuccessInOwnTransaction writes to the audit table an operation that has been committed in another database
+func (a *auditTrail) recordSuccessInOwnTransaction(ctx context.Context) {
+	a.recordInOwnTransaction(ctx, auditOutcomeSuccess, nil)
+}
+
+// recordInOwnTransaction writes an operation to the audit table in a transaction of its own, retried on transient
+// errors like the operations themselves. Failing to do so is only logged, so that the outcome of the operation itself
+// is reported.
+func (a *auditTrail) recordInOwnTransaction(ctx context.Context, outcome string, cause error) {
+	if a.cf.auditSchema == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditOwnTransactionTimeout)
+	defer cancel()
+
+	err := runTransaction(ctx, a.cf, func(tx *sql.Tx) error {
+		return a.record(ctx, tx, outcome, cause)
+	})
+	if err != nil {
+		tflog.SubsystemWarn(ctx, logSubsystem, "failed to record operation in audit log", map[string]any{
+			"outcome":     outcome,
+			logFieldError: a.cf.secrets.redact(err.Error()),
+		})
+	}
+}
+
+func (a *auditTrail) record(ctx context.Context, tx *sql.Tx, outcome string, cause error) error {
+	if err := createAuditTable(ctx, tx, a.cf.auditSchema); err != nil {
+		return err
+	}
+
+	var message sql.NullString
+	if cause != nil {
+		message = sql.NullString{String: a.cf.secrets.redact(cause.Error()), Valid: true}
+	}
+
+	return execStatement(ctx, tx,
+		fmt.Sprintf("INSERT INTO %s.%s (operation, username, statements, provider_version, outcome, error) VALUES ($1, $2, $3, $4, $5, $6)", pq.QuoteIdentifier(a.cf.auditSchema), auditTable),
+		a.operation, a.username, pq.StringArray(a.statements), Version, outcome, message,
+	)
+}
+
+func createAuditTable(ctx context.Context, tx transaction, schema string) error {
+	statements := []string{
+		fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", pq.QuoteIdentifier(schema)),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+			id               bigserial PRIMARY KEY,
+			occurred_at      timestamptz NOT NULL DEFAULT now(),
+			operation        text NOT NULL,
+			username         text NOT NULL,
+			statements       text[] NOT NULL,
+			provider_version text NOT NULL,
+			outcome          text NOT NULL,
+			error            text
+		)`, pq.QuoteIdentifier(schema), auditTable),
+	}
+	for _, statement := range statements {
+		if err := execStatement(ctx, tx, statement); err != nil {
+			return fmt.Errorf("creating audit table: %w", err)
+		}
+	}
+	return nil
+}
+
+// auditedTransaction records in its audit trail every statement run through it, with secrets masked
+type auditedTransaction struct {
+	*sql.Tx
+	trail *auditTrail
+}
+
+func (a *auditedTransaction) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	a.trail.statements = append(a.trail.statements, a.trail.cf.secrets.redact(query))
+	return a.Tx.ExecContext(ctx, query, args...)
+}
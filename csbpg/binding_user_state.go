@@ -0,0 +1,86 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// bindingUserState is what resourceBindingUserRead can observe about a binding user.
+// Each field corresponds to something sqlUserCreate sets up and that can be undone outside of Terraform.
+type bindingUserState struct {
+	accessRoleMember         bool
+	loginEnabled             bool
+	defaultPrivilegesGranted bool
+	// isolatedSchema is the schema named after the binding user, when it owns it and has it as search_path
+	isolatedSchema string
+}
+
+func (s bindingUserState) drifted() bool {
+	return !s.accessRoleMember || !s.loginEnabled || !s.defaultPrivilegesGranted
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inspectBindingUser reads the state of a binding user with the given access from the catalog.
+// Default privileges on tables, sequences, functions and types must be granted in every schema,
+// and are not needed by read-only binding users. The boolean result is false when the role does not exist.
+func inspectBindingUser(ctx context.Context, q rowQuerier, cf connectionFactory, username, access string) (bindingUserState, bool, error) {
+	defer traceCall(ctx, "inspectBindingUser")()
+
+	const query = `
+		SELECT
+			r.rolcanlogin,
+			EXISTS (
+				SELECT FROM pg_catalog.pg_auth_members m
+				JOIN pg_catalog.pg_roles g ON g.oid = m.roleid
+				WHERE m.member = r.oid AND g.rolname = CASE WHEN $5 THEN $4 ELSE $2 END
+			),
+			$5 OR NOT EXISTS (
+				SELECT FROM unnest($3::text[]) s(nspname)
+				CROSS JOIN (VALUES
+					('r', $2::text, 7), ('S', $2::text, 3), ('f', $2::text, 1), ('T', $2::text, 1),
+					('r', $4::text, 1), ('S', $4::text, 1), ('r', 'PUBLIC', 7)
+				) e(objtype, grantee, privileges)
+				WHERE (e.grantee <> 'PUBLIC' OR NOT $6)
+				AND (e.grantee <> $4 OR $6 OR EXISTS (SELECT FROM pg_catalog.pg_roles WHERE rolname = $4))
+				AND (
+					SELECT COUNT(DISTINCT p.privilege_type)
+					FROM pg_catalog.pg_default_acl a
+					JOIN pg_catalog.pg_namespace n ON n.oid = a.defaclnamespace
+					CROSS JOIN LATERAL aclexplode(a.defaclacl) p
+					WHERE a.defaclrole = r.oid
+					AND a.defaclobjtype = e.objtype::"char"
+					AND n.nspname = s.nspname
+					AND p.grantee = CASE e.grantee WHEN 'PUBLIC' THEN 0 ELSE (SELECT oid FROM pg_catalog.pg_roles WHERE rolname = e.grantee) END
+				) < e.privileges
+			),
+			COALESCE((
+				SELECT n.nspname
+				FROM pg_catalog.pg_namespace n
+				JOIN pg_catalog.pg_db_role_setting s ON s.setrole = r.oid
+				JOIN pg_catalog.pg_database db ON db.oid = s.setdatabase
+				WHERE n.nspname = r.rolname
+				AND n.nspowner = r.oid
+				AND db.datname = pg_catalog.current_database()
+				AND s.setconfig @> ARRAY['search_path=' || pg_catalog.quote_ident(r.rolname)]
+			), '')
+		FROM pg_catalog.pg_roles r
+		WHERE r.rolname = $1`
+
+	var s bindingUserState
+	err := q.QueryRowContext(ctx, query, username, cf.dataOwnerRole, pq.StringArray(cf.schemas), cf.readerRole, access == accessReadOnly, cf.revokePublicAccess).Scan(&s.loginEnabled, &s.accessRoleMember, &s.defaultPrivilegesGranted, &s.isolatedSchema)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return bindingUserState{}, false, nil
+	case err != nil:
+		return bindingUserState{}, false, fmt.Errorf("error inspecting role %q: %w", username, err)
+	default:
+		return s, true, nil
+	}
+}
@@ -0,0 +1,105 @@
+package csbpg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// maxIdentifierLength is the length in bytes beyond which PostgreSQL silently truncates identifiers (NAMEDATALEN - 1)
+const maxIdentifierLength = 63
+
+// passwordPolicy holds the optional provider-wide rules that binding passwords must follow.
+type passwordPolicy struct {
+	minLength           int
+	forbiddenCharacters string
+}
+
+func (p passwordPolicy) check(password string) error {
+	if utf8.RuneCountInString(password) < p.minLength {
+		return fmt.Errorf("password must be at least %d characters long", p.minLength)
+	}
+	if strings.ContainsAny(password, p.forbiddenCharacters) {
+		return fmt.Errorf("password must not contain any of the characters %q", p.forbiddenCharacters)
+	}
+	return nil
+}
+
+func validateBindingUsername(i any, path cty.Path) diag.Diagnostics {
+	username, ok := i.(string)
+	switch {
+	case !ok:
+		return diag.Diagnostics{{Severity: diag.Error, Summary: "Expected username to be a string", AttributePath: path}}
+	case username == "":
+		return diag.Diagnostics{{Severity: diag.Error, Summary: "Username must not be empty", AttributePath: path}}
+	case len(username) > maxIdentifierLength:
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Username is too long",
+			Detail:        fmt.Sprintf("PostgreSQL truncates role names to %d bytes, %q is %d bytes long.", maxIdentifierLength, username, len(username)),
+			AttributePath: path,
+		}}
+	case strings.HasPrefix(username, "pg_"):
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Username uses a reserved prefix",
+			Detail:        fmt.Sprintf("Role names starting with \"pg_\" are reserved by PostgreSQL, got %q.", username),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// validateBindingUserDiff rejects at plan time the binding users that would clash with the roles the provider is
+// configured with, and the passwords that do not follow the provider password policy.
+func validateBindingUserDiff(_ context.Context, d *schema.ResourceDiff, m any) error {
+	cf, ok := m.(connectionFactory)
+	if !ok {
+		return nil
+	}
+
+	if d.NewValueKnown(bindingUsernameKey) {
+		switch username := d.Get(bindingUsernameKey).(string); username {
+		case cf.username:
+			return fmt.Errorf("binding username %q must differ from the provider admin username", username)
+		case cf.dataOwnerRole:
+			return fmt.Errorf("binding username %q must differ from the provider data owner role", username)
+		case cf.readerRole:
+			return fmt.Errorf("binding username %q must differ from the provider reader role", username)
+		}
+	}
+
+	if d.Get(isolationKey).(string) == isolationSchema && d.NewValueKnown(bindingUsernameKey) {
+		// The schema of an isolated binding user is named after it, and must not be one that is shared
+		username := d.Get(bindingUsernameKey).(string)
+		if slices.Contains(cf.schemas, username) {
+			return fmt.Errorf("isolated binding username %q must differ from the schemas of the provider", username)
+		}
+		if username == cf.auditSchema {
+			return fmt.Errorf("isolated binding username %q must differ from the provider audit schema", username)
+		}
+	}
+
+	if d.Get(accessKey).(string) == accessReadOnly {
+		switch {
+		case d.Get(isolationKey).(string) == isolationSchema:
+			return fmt.Errorf("read-only binding users cannot be isolated in a schema of their own, as they would own it")
+		case !cf.revokePublicAccess:
+			return fmt.Errorf("read-only binding users require revoke_public_access in the provider configuration, as they would otherwise get the privileges of PUBLIC")
+		}
+	}
+
+	if d.NewValueKnown(bindingPasswordKey) && d.HasChange(bindingPasswordKey) {
+		if err := cf.passwordPolicy.check(d.Get(bindingPasswordKey).(string)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
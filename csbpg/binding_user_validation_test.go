@@ -0,0 +1,131 @@
+package csbpg
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("binding user validation", func() {
+	DescribeTable("rejects usernames PostgreSQL would truncate or reserve",
+		func(username, summary string) {
+			diags := validateBindingUsername(username, cty.GetAttrPath(bindingUsernameKey))
+			Expect(diags).To(HaveLen(1))
+			Expect(diags[0].Summary).To(Equal(summary))
+			Expect(diags[0].AttributePath).To(Equal(cty.GetAttrPath(bindingUsernameKey)))
+		},
+		Entry("empty", "", "Username must not be empty"),
+		Entry("longer than 63 bytes", strings.Repeat("a", 64), "Username is too long"),
+		Entry("longer than 63 bytes in UTF-8", strings.Repeat("é", 32), "Username is too long"),
+		Entry("reserved prefix", "pg_someuser", "Username uses a reserved prefix"),
+	)
+
+	It("accepts regular usernames", func() {
+		Expect(validateBindingUsername(strings.Repeat("a", 63), cty.GetAttrPath(bindingUsernameKey))).To(BeEmpty())
+		Expect(validateBindingUsername("some_pg_user", cty.GetAttrPath(bindingUsernameKey))).To(BeEmpty())
+	})
+
+	Describe("plan", func() {
+		factory := connectionFactory{
+			username:       "admin",
+			dataOwnerRole:  "binding_user_group",
+			readerRole:     "binding_user_group_reader",
+			passwordPolicy: passwordPolicy{minLength: 8, forbiddenCharacters: `'\`},
+		}
+
+		plan := func(username, password string) error {
+			config := terraform.NewResourceConfigRaw(map[string]any{
+				bindingUsernameKey: username,
+				bindingPasswordKey: password,
+			})
+			_, err := resourceBindingUser().Diff(context.TODO(), nil, config, factory)
+			return err
+		}
+
+		It("rejects the admin username", func() {
+			Expect(plan("admin", "long-enough")).To(MatchError(ContainSubstring("must differ from the provider admin username")))
+		})
+
+		It("rejects the data owner role", func() {
+			Expect(plan("binding_user_group", "long-enough")).To(MatchError(ContainSubstring("must differ from the provider data owner role")))
+		})
+
+		It("rejects the reader role", func() {
+			Expect(plan("binding_user_group_reader", "long-enough")).To(MatchError(ContainSubstring("must differ from the provider reader role")))
+		})
+
+		It("rejects read-only binding users isolated in a schema of their own", func() {
+			_, err := resourceBindingUser().Diff(context.TODO(), nil, terraform.NewResourceConfigRaw(map[string]any{
+				bindingUsernameKey: "someuser",
+				bindingPasswordKey: "long-enough",
+				accessKey:          accessReadOnly,
+				isolationKey:       isolationSchema,
+			}), factory)
+			Expect(err).To(MatchError(ContainSubstring("read-only binding users cannot be isolated")))
+		})
+
+		It("rejects read-only binding users unless the provider revokes the access of PUBLIC", func() {
+			config := terraform.NewResourceConfigRaw(map[string]any{
+				bindingUsernameKey: "someuser",
+				bindingPasswordKey: "long-enough",
+				accessKey:          accessReadOnly,
+			})
+			_, err := resourceBindingUser().Diff(context.TODO(), nil, config, factory)
+			Expect(err).To(MatchError(ContainSubstring("read-only binding users require revoke_public_access")))
+
+			revoking := factory
+			revoking.revokePublicAccess = true
+			_, err = resourceBindingUser().Diff(context.TODO(), nil, config, revoking)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects isolated binding users named after a schema of the provider", func() {
+			isolated := factory
+			isolated.schemas = []string{"public", "app"}
+			isolated.auditSchema = "audit"
+			for username, message := range map[string]string{
+				"app":   "must differ from the schemas of the provider",
+				"audit": "must differ from the provider audit schema",
+			} {
+				_, err := resourceBindingUser().Diff(context.TODO(), nil, terraform.NewResourceConfigRaw(map[string]any{
+					bindingUsernameKey: username,
+					bindingPasswordKey: "long-enough",
+					isolationKey:       isolationSchema,
+				}), isolated)
+				Expect(err).To(MatchError(ContainSubstring(message)), username)
+			}
+
+			_, err := resourceBindingUser().Diff(context.TODO(), nil, terraform.NewResourceConfigRaw(map[string]any{
+				bindingUsernameKey: "app",
+				bindingPasswordKey: "long-enough",
+			}), isolated)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("enforces the password policy without revealing the password", func() {
+			err := plan("someuser", "short")
+			Expect(err).To(MatchError(ContainSubstring("at least 8 characters")))
+			Expect(err.Error()).NotTo(ContainSubstring("short"))
+
+			err = plan("someuser", `it's-too-quoted`)
+			Expect(err).To(MatchError(ContainSubstring("must not contain")))
+			Expect(err.Error()).NotTo(ContainSubstring("quoted"))
+		})
+
+		It("accepts a binding user that follows the rules", func() {
+			Expect(plan("someuser", "long-enough")).To(Succeed())
+		})
+
+		It("does not enforce a password policy by default", func() {
+			_, err := resourceBindingUser().Diff(context.TODO(), nil, terraform.NewResourceConfigRaw(map[string]any{
+				bindingUsernameKey: "someuser",
+				bindingPasswordKey: "'",
+			}), connectionFactory{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
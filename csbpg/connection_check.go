@@ -0,0 +1,144 @@
+package csbpg
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/lib/pq"
+	"github.com/lib/pq/pqerror"
+)
+
+const connectionCheckTimeout = 30 * time.Second
+
+// checkConnection makes sure at configure time that the server can be reached with the provider settings and that
+// the admin user has the privileges that binding operations need, so that misconfigurations are not discovered
+// halfway through an apply.
+func checkConnection(ctx context.Context, cf connectionFactory) diag.Diagnostics {
+	defer traceCall(ctx, "checkConnection")()
+
+	ctx, cancel := context.WithTimeout(ctx, connectionCheckTimeout)
+	defer cancel()
+
+	db, err := cf.AdminPool()
+	if err != nil {
+		return diag.Errorf("connecting as admin: %s", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		return connectionDiagnostics(cf, err)
+	}
+
+	const query = `
+		SELECT
+			current_setting('server_version_num')::int,
+			r.rolsuper,
+			r.rolcreaterole,
+			has_database_privilege(current_database(), 'CREATE')
+		FROM pg_catalog.pg_roles r
+		WHERE r.rolname = current_user`
+
+	var (
+		serverVersion                     int
+		superuser, createRole, createInDB bool
+	)
+	if err := db.QueryRowContext(ctx, query).Scan(&serverVersion, &superuser, &createRole, &createInDB); err != nil {
+		return diag.Errorf("checking privileges of admin user %q: %s", cf.username, err)
+	}
+	tflog.SubsystemDebug(ctx, logSubsystem, "connected to PostgreSQL server", map[string]any{"server_version": serverVersion})
+
+	var diags diag.Diagnostics
+	if !superuser && !createRole {
+		diags = append(diags, attributeError(usernameKey,
+			"Admin user cannot create roles",
+			fmt.Sprintf("User %q needs the CREATEROLE attribute to manage binding users.", cf.username),
+		))
+	}
+	if superuser {
+		return diags
+	}
+
+	// Binding operations make the admin user the owner of the schemas, which takes the CREATE privilege on the database
+	// unless it owns them already
+	for _, schema := range cf.schemas {
+		var canAlterSchema, ownsSchema sql.NullBool
+		err := db.QueryRowContext(ctx, `
+			SELECT bool_or(pg_has_role(current_user, n.nspowner, 'USAGE')), bool_or(n.nspowner = r.oid)
+			FROM pg_catalog.pg_namespace n
+			JOIN pg_catalog.pg_roles r ON r.rolname = current_user
+			WHERE n.nspname = $1`, schema).Scan(&canAlterSchema, &ownsSchema)
+		switch {
+		case err != nil:
+			return append(diags, diag.Errorf("checking privileges of admin user %q on schema %q: %s", cf.username, schema, err)...)
+		case !canAlterSchema.Valid && !createInDB:
+			diags = append(diags, attributeError(schemasKey,
+				fmt.Sprintf("Admin user cannot create schema %s", schema),
+				fmt.Sprintf("Schema %q does not exist in database %q, and user %q needs the CREATE privilege on the database to create it.", schema, cf.database, cf.username),
+			))
+		case canAlterSchema.Valid && !canAlterSchema.Bool:
+			diags = append(diags, attributeError(usernameKey,
+				fmt.Sprintf("Admin user cannot alter schema %s", schema),
+				fmt.Sprintf("User %q must own schema %s in database %q, or be a member of the role that owns it.", cf.username, schema, cf.database),
+			))
+		case canAlterSchema.Valid && !ownsSchema.Bool && !createInDB:
+			diags = append(diags, attributeError(usernameKey,
+				fmt.Sprintf("Admin user cannot take ownership of schema %s", schema),
+				fmt.Sprintf("User %q is a member of the role that owns schema %s in database %q, but needs the CREATE privilege on the database to become its owner.", cf.username, schema, cf.database),
+			))
+		}
+	}
+	return diags
+}
+
+// connectionDiagnostics turns a failure to connect into a diagnostic pointing at the provider attribute most likely to be wrong
+func connectionDiagnostics(cf connectionFactory, err error) diag.Diagnostics {
+	var (
+		netErr       net.Error
+		dnsErr       *net.DNSError
+		unknownCAErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		certErr      x509.CertificateInvalidError
+	)
+
+	switch {
+	case pq.As(err, pqerror.InvalidPassword) != nil:
+		return diag.Diagnostics{attributeError(passwordKey, "Admin password rejected", err.Error())}
+	case pq.As(err, pqerror.InvalidAuthorizationSpecification) != nil:
+		return diag.Diagnostics{attributeError(usernameKey, "Admin user not authorized to connect", err.Error())}
+	case pq.As(err, pqerror.InvalidCatalogName) != nil:
+		return diag.Diagnostics{attributeError(databaseKey, "Database does not exist", err.Error())}
+	case errors.Is(err, pq.ErrSSLNotSupported):
+		return diag.Diagnostics{attributeError(sslModeKey, "Server does not support SSL", err.Error())}
+	case errors.As(err, &unknownCAErr), errors.As(err, &hostnameErr), errors.As(err, &certErr),
+		strings.Contains(err.Error(), "sslrootcert"):
+		return diag.Diagnostics{attributeError(sslRootCertKey, "Server certificate could not be verified", err.Error())}
+	case strings.Contains(err.Error(), "certificate") || strings.Contains(err.Error(), "tls:"):
+		return diag.Diagnostics{attributeError(clientCertKey, "TLS handshake failed", err.Error())}
+	case errors.As(err, &dnsErr):
+		return diag.Diagnostics{attributeError(hostKey, "Host not found", err.Error())}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return diag.Diagnostics{attributeError(portKey, fmt.Sprintf("Connection refused on port %d", cf.port), err.Error())}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return diag.Diagnostics{attributeError(hostKey, "Timed out connecting to server", err.Error())}
+	default:
+		return diag.Errorf("connecting to PostgreSQL server: %s", err)
+	}
+}
+
+func attributeError(key, summary, detail string) diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity:      diag.Error,
+		Summary:       summary,
+		Detail:        detail,
+		AttributePath: cty.GetAttrPath(key),
+	}
+}
@@ -0,0 +1,42 @@
+package csbpg
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/lib/pq"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("connectionDiagnostics", func() {
+	DescribeTable("points at the provider attribute that is most likely wrong",
+		func(err error, key string) {
+			diags := connectionDiagnostics(connectionFactory{port: 5432}, fmt.Errorf("connecting: %w", err))
+			Expect(diags).To(HaveLen(1))
+			Expect(diags[0].AttributePath).To(Equal(cty.GetAttrPath(key)))
+		},
+		Entry("wrong password", &pq.Error{Code: "28P01"}, passwordKey),
+		Entry("user not allowed by pg_hba.conf", &pq.Error{Code: "28000"}, usernameKey),
+		Entry("unknown database", &pq.Error{Code: "3D000"}, databaseKey),
+		Entry("SSL disabled on server", pq.ErrSSLNotSupported, sslModeKey),
+		Entry("unknown certificate authority", x509.UnknownAuthorityError{}, sslRootCertKey),
+		Entry("invalid root certificate", errors.New("pq: couldn't parse pem from sslrootcert"), sslRootCertKey),
+		Entry("client certificate rejected", errors.New("remote error: tls: bad certificate"), clientCertKey),
+		Entry("unknown host", &net.DNSError{Err: "no such host", Name: "nowhere"}, hostKey),
+		Entry("nothing listening", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, portKey),
+		Entry("unreachable host", context.DeadlineExceeded, hostKey),
+	)
+
+	It("does not guess an attribute for unknown errors", func() {
+		diags := connectionDiagnostics(connectionFactory{}, errors.New("boom"))
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].AttributePath).To(BeNil())
+		Expect(diags[0].Summary).To(Equal("connecting to PostgreSQL server: boom"))
+	})
+})
@@ -2,75 +2,125 @@ package csbpg
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
+	"strconv"
+	"sync"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
 type connectionFactory struct {
-	host          string
-	port          int
-	username      string
-	password      string
-	database      string
-	dataOwnerRole string
-	sslClientCert *clientCertificateConfig
-	sslRootCert   string
-	sslMode       string
+	host               string
+	port               int
+	username           string
+	password           string
+	database           string
+	dataOwnerRole      string
+	readerRole         string
+	schemas            []string
+	revokePublicAccess bool
+	sslClientCert      *clientCertificateConfig
+	sslRootCert        string
+	sslMode            string
+	lockTimeout        time.Duration
+	maxRetries         int
+	previewStatements  bool
+	auditSchema        string
+	passwordPolicy     passwordPolicy
+	pool               poolConfig
+	admin              *adminPool
+	secrets            *redactor
 }
 
-func (c connectionFactory) ConnectAsAdmin() (*sql.DB, error) {
-	return c.connect(c.uri())
+type poolConfig struct {
+	maxOpenConnections int
+	maxIdleConnections int
+	connMaxLifetime    time.Duration
+}
+
+// adminPool is created once per provider instance and shared by every copy of the connectionFactory
+type adminPool struct {
+	once sync.Once
+	db   *sql.DB
+	err  error
+}
+
+// AdminPool returns the connection pool shared by all operations that run as the admin user. It is opened on
+// first use. Callers must not close it; it is closed by Close when the provider stops.
+func (c connectionFactory) AdminPool() (*sql.DB, error) {
+	c.admin.once.Do(func() {
+		c.admin.db, c.admin.err = c.connect(c.uri())
+		if c.admin.err != nil {
+			return
+		}
+		c.admin.db.SetMaxOpenConns(c.pool.maxOpenConnections)
+		c.admin.db.SetMaxIdleConns(c.pool.maxIdleConnections)
+		c.admin.db.SetConnMaxLifetime(c.pool.connMaxLifetime)
+	})
+	return c.admin.db, c.admin.err
+}
+
+// forDatabase returns a factory connecting to another database of the server, with an admin pool of its own that
+// the caller must close
+func (c connectionFactory) forDatabase(database string) connectionFactory {
+	c.database = database
+	c.admin = &adminPool{}
+	return c
+}
+
+// Close closes the shared admin pool if it has been opened, and prevents it from being opened afterwards
+func (c connectionFactory) Close() error {
+	c.admin.once.Do(func() {
+		c.admin.err = errors.New("the provider has been stopped")
+	})
+	if c.admin.db == nil {
+		return nil
+	}
+	return c.admin.db.Close()
 }
 
 func (c connectionFactory) ConnectAsUser(bindingUser string, bindingUserPassword string) (*sql.DB, error) {
+	c.secrets.add(bindingUserPassword)
 	return c.connect(c.uriWithCreds(bindingUser, bindingUserPassword))
 }
 
 func (c connectionFactory) connect(uri string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", uri)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to PostgreSQL %q: %w", c.uriRedacted(), err)
+		return nil, fmt.Errorf("failed to connect to PostgreSQL %q: %w", c.secrets.redact(uri), err)
 	}
 
 	return db, nil
 }
+
 func (c connectionFactory) uriWithCreds(username, password string) string {
-	fields := map[string]string{
-		"host":     c.host,
-		"port":     fmt.Sprintf("%d", c.port),
-		"user":     username,
-		"password": password,
-		"database": c.database,
-		"sslmode":  c.sslMode,
+	params := []dsnParam{
+		{key: "host", value: c.host},
+		{key: "port", value: strconv.Itoa(c.port)},
+		{key: "user", value: username},
+		{key: "password", value: password},
+		{key: "dbname", value: c.database},
+		{key: "sslmode", value: c.sslMode},
 	}
 
 	if c.sslClientCert != nil {
-		fields["sslinline"] = "true"
-		fields["sslcert"] = fmt.Sprintf("'%s'", c.sslClientCert.Certificate)
-		fields["sslkey"] = fmt.Sprintf("'%s'", c.sslClientCert.Key)
-		fields["sslrootcert"] = fmt.Sprintf("'%s'", c.sslRootCert)
+		params = append(params,
+			dsnParam{key: "sslinline", value: "true"},
+			dsnParam{key: "sslcert", value: c.sslClientCert.Certificate},
+			dsnParam{key: "sslkey", value: c.sslClientCert.Key},
+			dsnParam{key: "sslrootcert", value: c.sslRootCert},
+		)
 	}
 
-	var s strings.Builder
-	for k, v := range fields {
-		s.WriteString(k)
-		s.WriteRune('=')
-		s.WriteString(v)
-		s.WriteRune(' ')
-	}
-	return s.String()
+	return buildDSN(params...)
 }
 
 func (c connectionFactory) uri() string {
 	return c.uriWithCreds(c.username, c.password)
 }
 
-func (c connectionFactory) uriRedacted() string {
-	return strings.ReplaceAll(c.uri(), c.password, "REDACTED")
-}
-
 type clientCertificateConfig struct {
 	Certificate string
 	Key         string
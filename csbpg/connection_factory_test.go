@@ -0,0 +1,61 @@
+package csbpg
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("connectionFactory", func() {
+	Describe("AdminPool", func() {
+		var factory connectionFactory
+
+		BeforeEach(func() {
+			factory = connectionFactory{
+				host:     "localhost",
+				port:     5432,
+				username: "admin",
+				password: "secret",
+				database: "db",
+				sslMode:  "disable",
+				pool: poolConfig{
+					maxOpenConnections: 3,
+					maxIdleConnections: 1,
+					connMaxLifetime:    time.Minute,
+				},
+				admin:   &adminPool{},
+				secrets: newRedactor("secret"),
+			}
+		})
+
+		It("is shared between copies of the factory", func() {
+			copied := factory
+
+			first, err := factory.AdminPool()
+			Expect(err).NotTo(HaveOccurred())
+			second, err := copied.AdminPool()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(second).To(BeIdenticalTo(first))
+			Expect(first.Stats().MaxOpenConnections).To(Equal(3))
+		})
+
+		It("cannot be used after the factory has been closed", func() {
+			_, err := factory.AdminPool()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(factory.Close()).To(Succeed())
+
+			db, err := factory.AdminPool()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(db.Ping()).To(MatchError(ContainSubstring("database is closed")))
+		})
+
+		It("is never opened once the factory has been closed", func() {
+			Expect(factory.Close()).To(Succeed())
+
+			_, err := factory.AdminPool()
+			Expect(err).To(MatchError("the provider has been stopped"))
+		})
+	})
+})
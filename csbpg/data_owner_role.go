@@ -1,37 +1,139 @@
 package csbpg
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
-	"log"
+	"strconv"
+	"strings"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/lib/pq"
 )
 
-func createDataOwnerRole(tx *sql.Tx, cf connectionFactory) error {
-	log.Println("[DEBUG] ENTRY createDataOwnerRole()")
-	defer log.Println("[DEBUG] EXIT createDataOwnerRole()")
+// createDataOwnerRole creates the data owner role if missing, and grants it the database, the schemas and the tables,
+// sequences, routines and large objects they contain. It runs on every bind, so the grants on objects are only issued
+// when the catalog shows that some are missing.
+func createDataOwnerRole(ctx context.Context, tx transaction, cf connectionFactory) error {
+	defer traceCall(ctx, "createDataOwnerRole")()
 
-	exists, err := roleExists(tx, cf.dataOwnerRole)
+	exists, err := roleExists(ctx, tx, cf.dataOwnerRole)
 	if err != nil {
 		return fmt.Errorf("checking whether dataowner exists: %w", err)
 	}
 
 	if !exists {
-		log.Println("[DEBUG] data owner role does not exist - creating")
-		if _, err := tx.Exec(fmt.Sprintf("CREATE ROLE %s WITH NOLOGIN", pq.QuoteIdentifier(cf.dataOwnerRole))); err != nil {
+		tflog.SubsystemDebug(ctx, logSubsystem, "data owner role does not exist - creating")
+		if err := execStatement(ctx, tx, fmt.Sprintf("CREATE ROLE %s WITH NOLOGIN", pq.QuoteIdentifier(cf.dataOwnerRole))); err != nil {
 			return fmt.Errorf("creating dataowner role: %w", err)
 		}
 	}
 
-	log.Println("[DEBUG] granting data owner role")
-	if _, err := tx.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s TO %s", pq.QuoteIdentifier(cf.database), pq.QuoteIdentifier(cf.dataOwnerRole))); err != nil {
+	tflog.SubsystemDebug(ctx, logSubsystem, "granting data owner role")
+	if err := execStatement(ctx, tx, fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s TO %s", pq.QuoteIdentifier(cf.database), pq.QuoteIdentifier(cf.dataOwnerRole))); err != nil {
 		return fmt.Errorf("granting database privilege to dataowner role: %w", err)
 	}
 
-	if _, err := tx.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO %s", pq.QuoteIdentifier(cf.dataOwnerRole))); err != nil {
-		return fmt.Errorf("granting table privilege to dataowner role: %w", err)
+	if err := grantAllPrivilegesToSchemas(ctx, tx, cf); err != nil {
+		return err
+	}
+
+	missing, err := findMissingDataOwnerPrivileges(ctx, tx, cf, exists)
+	if err != nil {
+		return err
+	}
+
+	var statements []string
+	for _, objects := range []struct {
+		kind    string
+		missing bool
+	}{{"TABLES", missing.tables}, {"SEQUENCES", missing.sequences}, {"ROUTINES", missing.routines}} {
+		if objects.missing {
+			statements = append(statements, fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL %s IN SCHEMA %s TO %s", objects.kind, quoteIdentifiers(cf.schemas), pq.QuoteIdentifier(cf.dataOwnerRole)))
+		}
+	}
+	if len(missing.largeObjects) > 0 {
+		oids := make([]string, len(missing.largeObjects))
+		for i, oid := range missing.largeObjects {
+			oids[i] = strconv.FormatInt(oid, 10)
+		}
+		statements = append(statements, fmt.Sprintf("GRANT ALL PRIVILEGES ON LARGE OBJECT %s TO %s", strings.Join(oids, ", "), pq.QuoteIdentifier(cf.dataOwnerRole)))
+	}
+	for _, statement := range statements {
+		if err := execStatement(ctx, tx, statement); err != nil {
+			return fmt.Errorf("granting object privileges to dataowner role: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// missingDataOwnerPrivileges tells which kinds of objects of the schemas the data owner role lacks privileges on.
+// Large objects do not belong to a schema and are listed one by one.
+type missingDataOwnerPrivileges struct {
+	tables       bool
+	sequences    bool
+	routines     bool
+	largeObjects pq.Int64Array
+}
+
+// findMissingDataOwnerPrivileges only considers the objects whose privileges the admin user can grant, i.e. the ones
+// owned by a role it is a member of. When the data owner role does not exist yet, which is the case of a preview as
+// CREATE ROLE is not run, it lacks privileges on all of them: the privilege functions would fail on its name.
+func findMissingDataOwnerPrivileges(ctx context.Context, q querier, cf connectionFactory, dataOwnerExists bool) (missingDataOwnerPrivileges, error) {
+	defer traceCall(ctx, "findMissingDataOwnerPrivileges")()
+
+	var missing missingDataOwnerPrivileges
+	rows, err := q.QueryContext(ctx, `
+		SELECT
+			EXISTS (
+				SELECT FROM pg_catalog.pg_class c
+				JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+				CROSS JOIN unnest(ARRAY['SELECT', 'INSERT', 'UPDATE', 'DELETE', 'TRUNCATE', 'REFERENCES', 'TRIGGER']) p
+				WHERE n.nspname = ANY($1)
+				AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+				AND pg_catalog.pg_has_role(current_user, c.relowner, 'MEMBER')
+				AND CASE WHEN $3 THEN NOT pg_catalog.has_table_privilege($2, c.oid, p) ELSE true END
+			),
+			EXISTS (
+				SELECT FROM pg_catalog.pg_class c
+				JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+				CROSS JOIN unnest(ARRAY['USAGE', 'SELECT', 'UPDATE']) p
+				WHERE n.nspname = ANY($1)
+				AND c.relkind = 'S'
+				AND pg_catalog.pg_has_role(current_user, c.relowner, 'MEMBER')
+				AND CASE WHEN $3 THEN NOT pg_catalog.has_sequence_privilege($2, c.oid, p) ELSE true END
+			),
+			EXISTS (
+				SELECT FROM pg_catalog.pg_proc f
+				JOIN pg_catalog.pg_namespace n ON n.oid = f.pronamespace
+				WHERE n.nspname = ANY($1)
+				AND pg_catalog.pg_has_role(current_user, f.proowner, 'MEMBER')
+				AND CASE WHEN $3 THEN NOT pg_catalog.has_function_privilege($2, f.oid, 'EXECUTE') ELSE true END
+			),
+			ARRAY(
+				SELECT l.oid
+				FROM pg_catalog.pg_largeobject_metadata l
+				WHERE pg_catalog.pg_has_role(current_user, l.lomowner, 'MEMBER')
+				AND CASE WHEN $3 THEN NOT pg_catalog.pg_has_role($2, l.lomowner, 'USAGE') ELSE true END
+				AND (
+					SELECT COUNT(DISTINCT a.privilege_type)
+					FROM aclexplode(l.lomacl) a
+					JOIN pg_catalog.pg_roles g ON g.oid = a.grantee
+					WHERE g.rolname = $2
+				) < 2
+				ORDER BY 1
+			)`, pq.StringArray(cf.schemas), cf.dataOwnerRole, dataOwnerExists)
+	if err != nil {
+		return missing, fmt.Errorf("checking privileges of dataowner role: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	if rows.Next() {
+		if err := rows.Scan(&missing.tables, &missing.sequences, &missing.routines, &missing.largeObjects); err != nil {
+			return missing, fmt.Errorf("checking privileges of dataowner role: %w", err)
+		}
+	}
+	return missing, rows.Err()
+}
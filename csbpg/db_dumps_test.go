@@ -2,9 +2,17 @@ package csbpg
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/lib/pq"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
@@ -29,6 +37,7 @@ func testBindingCommonOps(pgVersion, dumpFile string) {
 	})
 
 	AfterEach(func() {
+		Expect(factory.Close()).To(Succeed())
 		err = cleanPostgresInstance(pgVersion, dumpFile)
 		Expect(err).NotTo(HaveOccurred())
 	})
@@ -140,11 +149,595 @@ func testBindingCommonOps(pgVersion, dumpFile string) {
 		customSqlWorks("otheruser", "otheruser", factory, "SELECT COUNT(1) FROM TABLE1;")
 	})
 
+	It("allows bindings to insert into serial columns of tables created by other bindings", func() {
+		createUserWorks("someuser", "someuser", factory)
+		createUserWorks("otheruser", "otheruser", factory)
+
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE table1(id serial PRIMARY KEY, m text);")
+		customSqlWorks("someuser", "someuser", factory, "INSERT INTO table1(m) VALUES ('first');")
+		customSqlWorks("otheruser", "otheruser", factory, "INSERT INTO table1(m) VALUES ('second');")
+		customSqlReturns("otheruser", "otheruser", factory, "SELECT max(id)::text FROM table1;", "2")
+		customSqlReturns("otheruser", "otheruser", factory, "SELECT nextval('table1_id_seq')::text;", "3")
+
+		By("letting them use the functions and types of other bindings")
+		customSqlWorks("someuser", "someuser", factory, "CREATE TYPE mood AS ENUM ('happy', 'sad'); CREATE FUNCTION answer() RETURNS int LANGUAGE sql AS 'SELECT 42';")
+		customSqlWorks("otheruser", "otheruser", factory, "CREATE TABLE table2(m mood);")
+		customSqlReturns("otheruser", "otheruser", factory, "SELECT answer()::text;", "42")
+
+		By("revoking these default privileges, which would prevent dropping the role, when the binding is deleted")
+		deleteUserWorks("someuser", "someuser", factory)
+		customSqlWorks("otheruser", "otheruser", factory, "INSERT INTO table1(m) VALUES ('third');")
+	})
+
+	It("grants the data owner role the existing sequences, routines and large objects", func() {
+		adminSqlWorks(factory, "CREATE ROLE restorer NOLOGIN; GRANT restorer TO testuser;")
+		adminSqlWorks(factory, `SET ROLE restorer;
+			CREATE SEQUENCE restored_seq;
+			CREATE FUNCTION restored_fn() RETURNS int LANGUAGE sql AS 'SELECT 42';
+			REVOKE EXECUTE ON FUNCTION restored_fn() FROM PUBLIC;
+			SELECT lo_from_bytea(4242, 'restored');
+			RESET ROLE;`)
+
+		createUserWorks("someuser", "someuser", factory)
+
+		customSqlReturns("someuser", "someuser", factory, "SELECT nextval('restored_seq')::text;", "1")
+		customSqlReturns("someuser", "someuser", factory, "SELECT restored_fn()::text;", "42")
+		customSqlReturns("someuser", "someuser", factory, "SELECT convert_from(lo_get(4242), 'UTF8');", "restored")
+
+		By("not granting them again on the next bind")
+		factory.previewStatements = true
+		planned := plannedStatements(factory, nil, "otheruser", "otheruser")
+		Expect(strings.Join(planned, "\n")).NotTo(ContainSubstring("GRANT ALL PRIVILEGES ON ALL"))
+		Expect(strings.Join(planned, "\n")).NotTo(ContainSubstring("LARGE OBJECT"))
+	})
+
+	It("imports an existing binding user", func() {
+		createUserWorks("someuser", "someuser", factory)
+
+		d := resourceBindingUser().Data(nil)
+		d.SetId("testdb/someuser")
+		imported, err := resourceBindingUserImport(context.TODO(), d, factory)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imported).To(HaveLen(1))
+		Expect(imported[0].Id()).To(Equal("someuser"))
+		Expect(imported[0].Get(bindingUsernameKey)).To(Equal("someuser"))
+		Expect(imported[0].Get(accessKey)).To(Equal(accessReadWrite))
+	})
+
+	It("refuses to import roles that are not members of the data owner role", func() {
+		createUserWorks("someuser", "someuser", factory)
+		adminSqlWorks(factory, "CREATE ROLE outsider WITH LOGIN")
+
+		d := resourceBindingUser().Data(nil)
+		d.SetId("testdb/outsider")
+		_, err := resourceBindingUserImport(context.TODO(), d, factory)
+		Expect(err).To(MatchError(ContainSubstring(`role "outsider" is not a member of data owner role "binding_user_group" nor of reader role "binding_user_group_reader"`)))
+
+		d.SetId("testdb/missing")
+		_, err = resourceBindingUserImport(context.TODO(), d, factory)
+		Expect(err).To(MatchError(`role "missing" does not exist`))
+
+		d.SetId("otherdb/someuser")
+		_, err = resourceBindingUserImport(context.TODO(), d, factory)
+		Expect(err).To(MatchError(ContainSubstring(`import ID refers to database "otherdb"`)))
+	})
+
+	It("detects and repairs drift of a binding user", func() {
+		createUserWorks("someuser", "someuser", factory)
+
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+
+		state, exists, err := inspectBindingUser(context.TODO(), db, factory, "someuser", accessReadWrite)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(state.drifted()).To(BeFalse())
+
+		adminSqlWorks(factory, "REVOKE binding_user_group FROM someuser")
+		adminSqlWorks(factory, "ALTER ROLE someuser WITH NOLOGIN")
+		adminSqlWorks(factory, "ALTER DEFAULT PRIVILEGES FOR ROLE someuser IN SCHEMA PUBLIC REVOKE ALL ON TABLES FROM binding_user_group")
+
+		state, _, err = inspectBindingUser(context.TODO(), db, factory, "someuser", accessReadWrite)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(bindingUserState{}))
+
+		Expect(sqlUserRepair(context.TODO(), "someuser", bindingUserOptions{}, factory)).To(BeNil())
+
+		state, _, err = inspectBindingUser(context.TODO(), db, factory, "someuser", accessReadWrite)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.drifted()).To(BeFalse())
+	})
+
+	It("scopes bindings to the schemas of the provider, creating the missing ones", func() {
+		factory.schemas = []string{"public", "app"}
+		createUserWorks("someuser", "someuser", factory)
+		createUserWorks("otheruser", "otheruser", factory)
+
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE app.table1();")
+		customSqlWorks("otheruser", "otheruser", factory, "SELECT COUNT(1) FROM app.table1;")
+		customSqlReturns("otheruser", "otheruser", factory, "SELECT nspowner::regrole::text FROM pg_catalog.pg_namespace WHERE nspname = 'app'", "testuser")
+
+		By("detecting drift in any of the schemas")
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+		adminSqlWorks(factory, "ALTER DEFAULT PRIVILEGES FOR ROLE someuser IN SCHEMA app REVOKE ALL ON TABLES FROM binding_user_group")
+		state, _, err := inspectBindingUser(context.TODO(), db, factory, "someuser", accessReadWrite)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.defaultPrivilegesGranted).To(BeFalse())
+
+		deleteUserWorks("someuser", "someuser", factory)
+		customSqlWorks("otheruser", "otheruser", factory, "DROP TABLE app.table1;")
+
+		By("deleting binding users whose default privileges are in schemas removed from the provider")
+		createUserWorks("someuser", "someuser", factory)
+		factory.schemas = []string{"public"}
+		deleteUserWorks("someuser", "someuser", factory)
+	})
+
+	It("only sets up the reader role when read-only bindings can be created", func() {
+		createUserWorks("someuser", "someuser", factory)
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(roleExists(context.TODO(), db, "binding_user_group_reader")).To(BeFalse())
+		state, _, err := inspectBindingUser(context.TODO(), db, factory, "someuser", accessReadWrite)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.defaultPrivilegesGranted).To(BeTrue())
+
+		factory.revokePublicAccess = true
+		createUserWorks("otheruser", "otheruser", factory)
+		Expect(roleExists(context.TODO(), db, "binding_user_group_reader")).To(BeTrue())
+	})
+
+	It("prevents read-only bindings from writing", func() {
+		factory.revokePublicAccess = true
+		createUserWorks("someuser", "someuser", factory)
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE table1(id serial); INSERT INTO table1 DEFAULT VALUES;")
+
+		readOnly := bindingUserOptions{access: accessReadOnly}
+		Expect(sqlUserCreate(context.TODO(), "reader", "reader", readOnly, factory)).To(BeNil())
+
+		customSqlReturns("reader", "reader", factory, "SELECT COUNT(1) FROM table1;", "1")
+		customSqlReturns("reader", "reader", factory, "SELECT last_value::text FROM table1_id_seq;", "1")
+		customSqlFails("reader", "reader", factory, "INSERT INTO table1 DEFAULT VALUES;", "permission denied for table table1")
+		customSqlFails("reader", "reader", factory, "UPDATE table1 SET id = 2;", "permission denied for table table1")
+		customSqlFails("reader", "reader", factory, "DELETE FROM table1;", "permission denied for table table1")
+		customSqlFails("reader", "reader", factory, "TRUNCATE table1;", "permission denied for table table1")
+		customSqlFails("reader", "reader", factory, "CREATE TABLE table2();", "permission denied for schema public")
+
+		By("reading the tables created afterwards by read-write bindings")
+		createUserWorks("otheruser", "otheruser", factory)
+		customSqlWorks("otheruser", "otheruser", factory, "CREATE TABLE table2();")
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE table3();")
+		customSqlReturns("reader", "reader", factory, "SELECT COUNT(1) FROM table2;", "0")
+		customSqlReturns("reader", "reader", factory, "SELECT COUNT(1) FROM table3;", "0")
+		customSqlFails("reader", "reader", factory, "INSERT INTO table3 DEFAULT VALUES;", "permission denied for table table3")
+
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+		state, _, err := inspectBindingUser(context.TODO(), db, factory, "reader", accessReadOnly)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.drifted()).To(BeFalse())
+
+		deleteUserWorks("reader", "reader", factory)
+	})
+
+	It("isolates bindings in schemas of their own", func() {
+		isolated := bindingUserOptions{isolation: isolationSchema}
+		Expect(sqlUserCreate(context.TODO(), "someuser", "someuser", isolated, factory)).To(BeNil())
+		Expect(sqlUserCreate(context.TODO(), "otheruser", "otheruser", isolated, factory)).To(BeNil())
+
+		customSqlReturns("someuser", "someuser", factory, "SELECT current_schema();", "someuser")
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE table1();")
+		customSqlReturns("someuser", "someuser", factory, "SELECT schemaname FROM pg_tables WHERE tablename = 'table1'", "someuser")
+		customSqlFails("otheruser", "otheruser", factory, "SELECT COUNT(1) FROM someuser.table1;", "permission denied for schema someuser")
+
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+		state, _, err := inspectBindingUser(context.TODO(), db, factory, "someuser", accessReadWrite)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.isolatedSchema).To(Equal("someuser"))
+
+		By("reassigning the schema and its contents to the data owner role on deletion")
+		Expect(sqlUserDelete(context.TODO(), "someuser", "someuser", isolated, factory)).To(BeEmpty())
+		customSqlReturns("otheruser", "otheruser", factory, "SELECT nspowner::regrole::text FROM pg_catalog.pg_namespace WHERE nspname = 'someuser'", "binding_user_group")
+		customSqlReturns("otheruser", "otheruser", factory, "SELECT tableowner FROM pg_tables WHERE tablename = 'table1'", "binding_user_group")
+	})
+
+	It("imports the access and isolation of existing binding users without planning a replacement", func() {
+		factory.revokePublicAccess = true
+		createUserWorks("someuser", "someuser", factory)
+		Expect(sqlUserCreate(context.TODO(), "reader", "reader", bindingUserOptions{access: accessReadOnly}, factory)).To(BeNil())
+		Expect(sqlUserCreate(context.TODO(), "isolated", "isolated", bindingUserOptions{isolation: isolationSchema}, factory)).To(BeNil())
+
+		for username, config := range map[string]map[string]any{
+			"someuser": {accessKey: accessReadWrite, isolationKey: isolationShared},
+			"reader":   {accessKey: accessReadOnly, isolationKey: isolationShared},
+			"isolated": {accessKey: accessReadWrite, isolationKey: isolationSchema},
+		} {
+			d := resourceBindingUser().Data(nil)
+			d.SetId("testdb/" + username)
+			imported, err := resourceBindingUserImport(context.TODO(), d, factory)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(imported[0].Get(accessKey)).To(Equal(config[accessKey]), username)
+			Expect(imported[0].Get(isolationKey)).To(Equal(config[isolationKey]), username)
+			Expect(resourceBindingUserRead(context.TODO(), imported[0], factory)).To(BeEmpty())
+
+			config[bindingUsernameKey] = username
+			config[bindingPasswordKey] = username
+			diff, err := resourceBindingUser().Diff(context.TODO(), imported[0].State(), terraform.NewResourceConfigRaw(config), factory)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(diff.RequiresNew()).To(BeFalse(), username)
+		}
+	})
+
+	It("warns when an existing role is adopted as a binding user", func() {
+		adminSqlWorks(factory, "CREATE ROLE legacyuser WITH LOGIN PASSWORD 'legacy'")
+
+		diags := sqlUserCreate(context.TODO(), "legacyuser", "legacyuser", bindingUserOptions{}, factory)
+		Expect(diags.HasError()).To(BeFalse())
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Severity).To(Equal(diag.Warning))
+		Expect(diags[0].Detail).To(ContainSubstring("Its password has been set from the configuration."))
+	})
+
+	It("serializes binding operations across connections", func() {
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+
+		tx, err := db.Begin()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acquireBindingLock(context.TODO(), tx, factory)).To(Succeed())
+
+		impatientFactory := factory
+		impatientFactory.lockTimeout = time.Second
+		diags := sqlUserCreate(context.TODO(), "someuser", "someuser", bindingUserOptions{}, impatientFactory)
+		Expect(diags.HasError()).To(BeTrue())
+		Expect(diags[0].Summary).To(ContainSubstring(`timed out after 1s waiting for other binding operations on database "testdb" to finish`))
+
+		By("giving up before the resource timeout when it comes first")
+		ctx, cancel := context.WithTimeout(context.TODO(), 2*time.Second)
+		defer cancel()
+		diags = sqlUserCreate(ctx, "someuser", "someuser", bindingUserOptions{}, factory)
+		Expect(diags.HasError()).To(BeTrue())
+		Expect(diags[0].Summary).To(ContainSubstring(`waiting for other binding operations on database "testdb" to finish`))
+
+		Expect(tx.Rollback()).To(Succeed())
+		createUserWorks("someuser", "someuser", factory)
+	})
+
+	It("fails with a clear diagnostic when a statement is blocked beyond the resource timeout", func() {
+		createUserWorks("someuser", "someuser", factory)
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE TABLE1();")
+
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+		tx, err := db.Begin()
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback()
+		_, err = tx.Exec("LOCK TABLE TABLE1 IN ACCESS EXCLUSIVE MODE")
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 2*time.Second)
+		defer cancel()
+		diags := sqlUserDelete(ctx, "someuser", "someuser", bindingUserOptions{}, factory)
+		Expect(diags.HasError()).To(BeTrue())
+		Expect(diags[0].Summary).To(ContainSubstring("timed out waiting for a lock held by another session"))
+
+		Expect(tx.Rollback()).To(Succeed())
+		deleteUserWorks("someuser", "someuser", factory)
+	})
+
+	It("verifies connectivity and admin privileges", func() {
+		Expect(checkConnection(context.TODO(), factory)).To(BeEmpty())
+
+		adminSqlWorks(factory, "CREATE ROLE weakadmin WITH LOGIN")
+		weakFactory := factory
+		weakFactory.username = "weakadmin"
+		weakFactory.admin = &adminPool{}
+		defer weakFactory.Close()
+
+		diags := checkConnection(context.TODO(), weakFactory)
+		Expect(diags).To(HaveLen(2))
+		Expect(diags[0].Summary).To(Equal("Admin user cannot create roles"))
+		Expect(diags[1].Summary).To(Equal("Admin user cannot alter schema public"))
+
+		By("requiring the CREATE privilege on the database to take ownership of a schema owned by another role")
+		adminSqlWorks(factory, "CREATE ROLE schemaowner; CREATE SCHEMA app AUTHORIZATION schemaowner; GRANT schemaowner TO weakadmin; ALTER ROLE weakadmin CREATEROLE;")
+		weakFactory.schemas = []string{"app"}
+		diags = checkConnection(context.TODO(), weakFactory)
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Summary).To(Equal("Admin user cannot take ownership of schema app"))
+	})
+
+	It("reports a missing database against the database attribute", func() {
+		wrongFactory := factory
+		wrongFactory.database = "nosuchdb"
+		wrongFactory.admin = &adminPool{}
+		defer wrongFactory.Close()
+
+		diags := checkConnection(context.TODO(), wrongFactory)
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Summary).To(Equal("Database does not exist"))
+	})
+
+	It("previews the statements of a new binding user without running them", func() {
+		factory.previewStatements = true
+
+		planned := plannedStatements(factory, nil, "someuser", "secret-password")
+		Expect(planned).To(ContainElements(
+			`ALTER SCHEMA "public" OWNER TO "testuser"`,
+			`GRANT ALL ON SCHEMA "public" TO PUBLIC`,
+			`CREATE ROLE "someuser" WITH LOGIN PASSWORD 'REDACTED' INHERIT IN ROLE "binding_user_group"`,
+			`GRANT "someuser" TO "testuser"`,
+			`ALTER DEFAULT PRIVILEGES FOR ROLE "someuser" IN SCHEMA "public" GRANT ALL ON TABLES TO "binding_user_group"`,
+			`ALTER DEFAULT PRIVILEGES FOR ROLE "someuser" IN SCHEMA "public" GRANT ALL ON TABLES TO PUBLIC`,
+		))
+		Expect(strings.Join(planned, "\n")).NotTo(ContainSubstring("secret-password"))
+
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(roleExists(context.TODO(), db, "someuser")).To(BeFalse())
+	})
+
+	It("previews the first binding user of a data owner role that does not exist yet", func() {
+		adminSqlWorks(factory, "CREATE ROLE restorer NOLOGIN; GRANT restorer TO testuser;")
+		adminSqlWorks(factory, `SET ROLE restorer;
+			CREATE TABLE restored_table();
+			CREATE SEQUENCE restored_seq;
+			CREATE FUNCTION restored_fn() RETURNS int LANGUAGE sql AS 'SELECT 42';
+			RESET ROLE;`)
+		factory.dataOwnerRole = "fresh_data_owner"
+		factory.readerRole = "fresh_data_owner_reader"
+		factory.previewStatements = true
+
+		planned := plannedStatements(factory, nil, "someuser", "someuser")
+		Expect(planned).To(ContainElements(
+			`CREATE ROLE "fresh_data_owner" WITH NOLOGIN`,
+			`GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA "public" TO "fresh_data_owner"`,
+			`GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA "public" TO "fresh_data_owner"`,
+			`GRANT ALL PRIVILEGES ON ALL ROUTINES IN SCHEMA "public" TO "fresh_data_owner"`,
+		))
+
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(roleExists(context.TODO(), db, "fresh_data_owner")).To(BeFalse())
+	})
+
+	It("previews the adoption of a legacy user", func() {
+		factory.previewStatements = true
+		adminSqlWorks(factory, "CREATE ROLE legacyuser WITH LOGIN PASSWORD 'legacy'")
+		adminSqlWorks(factory, "DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_catalog.pg_roles WHERE rolname = 'binding_group') THEN CREATE ROLE binding_group; END IF; END $$")
+
+		planned := plannedStatements(factory, nil, "legacyuser", "secret-password")
+		Expect(planned).To(ContainElements(
+			`GRANT "legacyuser" TO "testuser"`,
+			`GRANT "binding_user_group" TO "legacyuser"`,
+			`ALTER DEFAULT PRIVILEGES FOR ROLE "legacyuser" REVOKE ALL ON TABLES FROM binding_group`,
+			`ALTER ROLE "legacyuser" WITH PASSWORD 'REDACTED'`,
+		))
+		Expect(planned).NotTo(ContainElement(HavePrefix("CREATE ROLE")))
+	})
+
+	It("previews the replacement of a binding user", func() {
+		createUserWorks("someuser", "someuser", factory)
+		factory.previewStatements = true
+
+		state := &terraform.InstanceState{
+			ID:         "someuser",
+			Attributes: map[string]string{bindingUsernameKey: "someuser", bindingPasswordKey: "someuser"},
+			RawState: cty.ObjectVal(map[string]cty.Value{
+				bindingUsernameKey: cty.StringVal("someuser"),
+				bindingPasswordKey: cty.StringVal("someuser"),
+			}),
+		}
+		planned := plannedStatements(factory, state, "otheruser", "someuser")
+		Expect(planned).To(ContainElements(
+			`REASSIGN OWNED BY CURRENT_USER TO "binding_user_group"`,
+			`DROP OWNED BY "someuser"`,
+			`DROP ROLE "someuser"`,
+			`CREATE ROLE "otheruser" WITH LOGIN PASSWORD 'REDACTED' INHERIT IN ROLE "binding_user_group"`,
+		))
+		customSqlWorks("someuser", "someuser", factory, "SELECT 1")
+	})
+
+	It("records binding operations in the audit log", func() {
+		factory.auditSchema = "csbpg_audit"
+		createUserWorks("someuser", "secret-password", factory)
+		customSqlWorks("someuser", "secret-password", factory, "CREATE TABLE kept();")
+		Expect(sqlUserDelete(context.TODO(), "someuser", "", bindingUserOptions{onDeleteOwnedObjects: onDeleteOwnedObjectsFail}, factory)).To(HaveLen(1))
+		deleteUserWorks("someuser", "secret-password", factory)
+
+		db, err := factory.AdminPool()
+		Expect(err).NotTo(HaveOccurred())
+		rows, err := db.Query("SELECT operation, username, statements, provider_version, outcome, error FROM csbpg_audit.csbpg_audit_log ORDER BY id")
+		Expect(err).NotTo(HaveOccurred())
+		defer rows.Close()
+
+		var (
+			operations []string
+			statements [][]string
+			errors     []string
+		)
+		for rows.Next() {
+			var (
+				operation, username, version, outcome string
+				executed                              pq.StringArray
+				message                               sql.NullString
+			)
+			Expect(rows.Scan(&operation, &username, &executed, &version, &outcome, &message)).To(Succeed())
+			operations = append(operations, strings.Join([]string{operation, username, version, outcome}, " "))
+			statements = append(statements, executed)
+			errors = append(errors, message.String)
+		}
+		Expect(rows.Err()).NotTo(HaveOccurred())
+
+		Expect(operations).To(Equal([]string{
+			"create someuser dev success",
+			"delete someuser dev failure",
+			"delete someuser dev success",
+		}))
+		Expect(statements[0]).To(ContainElement(`CREATE ROLE "someuser" WITH LOGIN PASSWORD 'REDACTED' INHERIT IN ROLE "binding_user_group"`))
+		Expect(statements[2]).To(ContainElement(`DROP ROLE "someuser"`))
+		Expect(errors[1]).To(ContainSubstring("still owns 1 objects: table kept"))
+		Expect(errors[0]).To(BeEmpty())
+		Expect(errors[2]).To(BeEmpty())
+		Expect(statements).NotTo(ContainElement(ContainElement(ContainSubstring("secret-password"))))
+	})
+
+	It("deletes a binding user whose grantees and schemas of the provider do not exist yet", func() {
+		createUserWorks("someuser", "someuser", factory)
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE kept();")
+
+		upgraded := factory
+		upgraded.readerRole = "never_created_reader"
+		upgraded.schemas = []string{"public", "never_created"}
+		deleteUserWorks("someuser", "someuser", upgraded)
+
+		customSqlFails("someuser", "someuser", factory, "SELECT 1;", `role "someuser" does not exist`)
+	})
+
+	It("treats a binding user dropped outside of Terraform as already deleted", func() {
+		createUserWorks("someuser", "someuser", factory)
+		adminSqlWorks(factory, "DROP OWNED BY someuser; DROP ROLE someuser")
+
+		diags := sqlUserDelete(context.TODO(), "someuser", "someuser", bindingUserOptions{sessionTermination: sessionTerminationTerminate}, factory)
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Severity).To(Equal(diag.Warning))
+		Expect(diags[0].Summary).To(Equal("Binding user already deleted"))
+	})
+
+	It("terminates the open sessions of a binding user when deleting it", func() {
+		createUserWorks("someuser", "someuser", factory)
+		session, err := factory.ConnectAsUser("someuser", "someuser")
+		Expect(err).NotTo(HaveOccurred())
+		defer session.Close()
+		Expect(session.Ping()).To(Succeed())
+
+		opts := bindingUserOptions{sessionTermination: sessionTerminationTerminate, sessionTerminationGracePeriod: time.Second}
+		Expect(sqlUserDelete(context.TODO(), "someuser", "someuser", opts, factory)).To(BeEmpty())
+
+		_, err = session.Exec("SELECT 1")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("waits for the open sessions of a binding user to end before deleting it", func() {
+		createUserWorks("someuser", "someuser", factory)
+		session, err := factory.ConnectAsUser("someuser", "someuser")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(session.Ping()).To(Succeed())
+
+		opts := bindingUserOptions{sessionTermination: sessionTerminationWait, sessionTerminationGracePeriod: time.Second}
+		diags := sqlUserDelete(context.TODO(), "someuser", "someuser", opts, factory)
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Summary).To(ContainSubstring(`binding user "someuser" still has 1 open sessions`))
+
+		By("refusing new sessions in the meantime")
+		refused, err := factory.ConnectAsUser("someuser", "someuser")
+		Expect(err).NotTo(HaveOccurred())
+		defer refused.Close()
+		Expect(refused.Ping()).To(MatchError(ContainSubstring("not permitted to log in")))
+
+		Expect(session.Close()).To(Succeed())
+		Expect(sqlUserDelete(context.TODO(), "someuser", "someuser", opts, factory)).To(BeEmpty())
+	})
+
+	It("drops the objects of a binding user on deletion when configured to", func() {
+		createUserWorks("someuser", "someuser", factory)
+		createUserWorks("otheruser", "otheruser", factory)
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE scratch();")
+
+		opts := bindingUserOptions{onDeleteOwnedObjects: onDeleteOwnedObjectsDrop}
+		Expect(sqlUserDelete(context.TODO(), "someuser", "someuser", opts, factory)).To(BeEmpty())
+
+		customSqlFails("otheruser", "otheruser", factory, "SELECT COUNT(1) FROM scratch;", `relation "scratch" does not exist`)
+	})
+
+	It("refuses to delete a binding user that owns objects when configured to", func() {
+		createUserWorks("someuser", "someuser", factory)
+		customSqlWorks("someuser", "someuser", factory, "CREATE TABLE kept();")
+		customSqlWorks("someuser", "someuser", factory, "CREATE SEQUENCE kept_seq;")
+		session, err := factory.ConnectAsUser("someuser", "someuser")
+		Expect(err).NotTo(HaveOccurred())
+		defer session.Close()
+		Expect(session.Ping()).To(Succeed())
+
+		opts := bindingUserOptions{onDeleteOwnedObjects: onDeleteOwnedObjectsFail, sessionTermination: sessionTerminationTerminate}
+		diags := sqlUserDelete(context.TODO(), "someuser", "someuser", opts, factory)
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Summary).To(Equal("Binding user still owns objects"))
+		Expect(diags[0].Detail).To(ContainSubstring("  - sequence kept_seq\n  - table kept\n"))
+
+		By("leaving the sessions and the login of the binding user alone")
+		Expect(session.Ping()).To(Succeed())
+		customSqlWorks("someuser", "someuser", factory, "SELECT COUNT(1) FROM kept;")
+
+		customSqlWorks("someuser", "someuser", factory, "DROP TABLE kept; DROP SEQUENCE kept_seq;")
+		Expect(sqlUserDelete(context.TODO(), "someuser", "someuser", opts, factory)).To(BeEmpty())
+	})
+
+	It("cleans up a binding user in the other databases of the server on deletion", func() {
+		createUserWorks("someuser", "someuser", factory)
+
+		otherAsUser, dropOtherDatabase := createOtherDatabase(factory, "someuser")
+		defer dropOtherDatabase()
+		customSqlWorks("someuser", "someuser", otherAsUser, "CREATE TABLE scratch();")
+
+		diags := sqlUserDelete(context.TODO(), "someuser", "someuser", bindingUserOptions{}, factory)
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Severity).To(Equal(diag.Warning))
+		Expect(diags[0].Summary).To(Equal("Cleaned up binding user in other databases"))
+		Expect(diags[0].Detail).To(ContainSubstring(`database "otherdb":`))
+		Expect(diags[0].Detail).To(ContainSubstring(`reassigned table scratch to "binding_user_group"`))
+		Expect(diags[0].Detail).To(ContainSubstring("revoked privileges on table granted"))
+
+		customSqlFails("someuser", "someuser", factory, "SELECT 1;", `role "someuser" does not exist`)
+	})
+
+	It("refuses to delete a binding user that owns objects in other databases before cleaning up any", func() {
+		createUserWorks("someuser", "someuser", factory)
+
+		otherAsUser, dropOtherDatabase := createOtherDatabase(factory, "someuser")
+		defer dropOtherDatabase()
+		customSqlWorks("someuser", "someuser", otherAsUser, "CREATE TABLE scratch();")
+
+		opts := bindingUserOptions{onDeleteOwnedObjects: onDeleteOwnedObjectsFail}
+		diags := sqlUserDelete(context.TODO(), "someuser", "someuser", opts, factory)
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Summary).To(Equal("Binding user still owns objects"))
+		Expect(diags[0].Detail).To(ContainSubstring(`  - table scratch in database "otherdb"`))
+
+		customSqlWorks("someuser", "someuser", otherAsUser, "SELECT COUNT(1) FROM granted;")
+		customSqlWorks("someuser", "someuser", otherAsUser, "DROP TABLE scratch;")
+		diags = sqlUserDelete(context.TODO(), "someuser", "someuser", opts, factory)
+		Expect(diags).To(HaveLen(1))
+		Expect(diags[0].Summary).To(Equal("Cleaned up binding user in other databases"))
+	})
+
+	DescribeTable("creates and deletes binding users with hostile usernames and passwords",
+		func(username, password string) {
+			createUserWorks(username, password, factory)
+			customSqlReturns(username, password, factory, "SELECT current_user", username)
+			customSqlWorks(username, password, factory, "CREATE TABLE hostile();")
+			customSqlReturns(username, password, factory, "SELECT COUNT(1) FROM pg_catalog.pg_roles WHERE rolname = 'testuser'", "1")
+			deleteUserWorks(username, password, factory)
+
+			createUserWorks("otheruser", "otheruser", factory)
+			customSqlWorks("otheruser", "otheruser", factory, "SELECT COUNT(1) FROM hostile;")
+		},
+		Entry("quote in the password", "someuser", "it's"),
+		Entry("escaped quote in the password", "someuser", `\' OR 1=1 --`),
+		Entry("statement injection in the password", "someuser", `'; DROP ROLE testuser; --`),
+		Entry("backslashes in the password", "someuser", `C:\\path\`),
+		Entry("quote in the username", "o'brien", "someuser"),
+		Entry("statement injection in the username", `x'; DROP ROLE testuser; --`, "someuser"),
+		Entry("double quotes and backslashes in the username", `some"user\`, `some"pass\`),
+	)
+
 	It("can perform all common operations with bindings", func() {
 		ctx := context.TODO()
 
 		By("creating a new user", func() {
-			diag := sqlUserCreate(ctx, "someuser", "someuser", factory)
+			diag := sqlUserCreate(ctx, "someuser", "someuser", bindingUserOptions{}, factory)
 			Expect(diag).To(BeNil())
 		})
 
@@ -157,12 +750,12 @@ func testBindingCommonOps(pgVersion, dumpFile string) {
 		})
 
 		By("creating a second user", func() {
-			diag := sqlUserCreate(ctx, "otheruser", "otheruser", factory)
+			diag := sqlUserCreate(ctx, "otheruser", "otheruser", bindingUserOptions{}, factory)
 			Expect(diag).To(BeNil())
 		})
 
 		By("deleting the first user", func() {
-			diag := sqlUserDelete(ctx, "someuser", "someuser", factory)
+			diag := sqlUserDelete(ctx, "someuser", "someuser", bindingUserOptions{}, factory)
 			Expect(diag).To(BeNil())
 		})
 
@@ -215,7 +808,15 @@ func preparePostgresInstance(pgVersion, dumpFile string) (connectionFactory, err
 		password:      "password-test",
 		database:      "testdb",
 		dataOwnerRole: "binding_user_group",
+		readerRole:    "binding_user_group_reader",
+		schemas:       []string{"public"},
 		sslMode:       "disable",
+		pool: poolConfig{
+			maxOpenConnections: 5,
+			maxIdleConnections: 2,
+		},
+		admin:   &adminPool{},
+		secrets: newRedactor("password-test"),
 	}, nil
 }
 
@@ -238,15 +839,43 @@ func cleanPostgresInstance(pgVersion, dumpFile string) error {
 }
 
 func createUserWorks(user, password string, factory connectionFactory) {
-	diag := sqlUserCreate(context.TODO(), user, password, factory)
+	diag := sqlUserCreate(context.TODO(), user, password, bindingUserOptions{}, factory)
 	Expect(diag).To(BeNil())
 }
 
 func deleteUserWorks(user, password string, factory connectionFactory) {
-	diag := sqlUserDelete(context.TODO(), user, password, factory)
+	diag := sqlUserDelete(context.TODO(), user, password, bindingUserOptions{}, factory)
 	Expect(diag).To(BeNil())
 }
 
+// createOtherDatabase creates the database otherdb next to the one of the factory, with a table "granted" that the
+// grantee can read, and returns a factory connecting to it along with a function dropping it
+func createOtherDatabase(factory connectionFactory, grantee string) (connectionFactory, func()) {
+	superuser := factory
+	superuser.username = "restoredump"
+	superuser.password = "restoredump"
+	superuser = superuser.forDatabase("restoredump")
+	adminSqlWorks(superuser, "CREATE DATABASE otherdb")
+
+	other := superuser.forDatabase("otherdb")
+	adminSqlWorks(other, fmt.Sprintf("GRANT ALL ON SCHEMA public TO PUBLIC; CREATE TABLE granted(); GRANT SELECT ON granted TO %s;", pq.QuoteIdentifier(grantee)))
+	Expect(other.Close()).To(Succeed())
+
+	otherAsUser := factory
+	otherAsUser.database = "otherdb"
+	return otherAsUser, func() {
+		adminSqlWorks(superuser, "DROP DATABASE otherdb")
+		Expect(superuser.Close()).To(Succeed())
+	}
+}
+
+func adminSqlWorks(factory connectionFactory, sql string) {
+	db, err := factory.AdminPool()
+	Expect(err).NotTo(HaveOccurred())
+	_, err = db.Exec(sql)
+	Expect(err).NotTo(HaveOccurred())
+}
+
 func customSqlWorks(user, password string, factory connectionFactory, sql string) {
 	db, err := factory.ConnectAsUser(user, password)
 	Expect(err).NotTo(HaveOccurred())
@@ -276,3 +905,20 @@ func customSqlReturns(user, password string, factory connectionFactory, sql, exp
 	Expect(err).NotTo(HaveOccurred())
 	Expect(output).To(Equal(expected))
 }
+
+func plannedStatements(factory connectionFactory, state *terraform.InstanceState, username, password string) []string {
+	config := terraform.NewResourceConfigRaw(map[string]any{
+		bindingUsernameKey: username,
+		bindingPasswordKey: password,
+	})
+	diff, err := resourceBindingUser().Diff(context.TODO(), state, config, factory)
+	Expect(err).NotTo(HaveOccurred())
+
+	count, err := strconv.Atoi(diff.Attributes[plannedStatementsKey+".#"].New)
+	Expect(err).NotTo(HaveOccurred())
+	statements := make([]string, 0, count)
+	for i := range count {
+		statements = append(statements, diff.Attributes[fmt.Sprintf("%s.%d", plannedStatementsKey, i)].New)
+	}
+	return statements
+}
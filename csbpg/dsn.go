@@ -0,0 +1,21 @@
+package csbpg
+
+import "strings"
+
+type dsnParam struct {
+	key   string
+	value string
+}
+
+var dsnValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// buildDSN formats params as a libpq keyword/value connection string, in the order given. Every value is quoted
+// and escaped following the libpq rules, so that values containing spaces, quotes, backslashes or newlines
+// (such as passwords and inline PEM data) reach the driver unchanged.
+func buildDSN(params ...dsnParam) string {
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		parts = append(parts, p.key+"='"+dsnValueEscaper.Replace(p.value)+"'")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,54 @@
+package csbpg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/lib/pq"
+)
+
+const (
+	isolationShared = "shared"
+	isolationSchema = "schema"
+)
+
+// isolateBindingUser gives a binding user a schema of its own, named after it and owned by it, and makes it the only
+// schema in its search_path in the database of the provider
+func isolateBindingUser(ctx context.Context, tx transaction, cf connectionFactory, username string) error {
+	tflog.SubsystemDebug(ctx, logSubsystem, "isolating binding user in its own schema")
+
+	exists, err := schemaExists(ctx, tx, username)
+	if err != nil {
+		return err
+	}
+
+	statement := fmt.Sprintf("CREATE SCHEMA %s AUTHORIZATION %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(username))
+	if exists {
+		statement = fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(username))
+	}
+	statements := []string{
+		statement,
+		fmt.Sprintf("ALTER ROLE %s IN DATABASE %s SET search_path = %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(cf.database), pq.QuoteIdentifier(username)),
+	}
+	for _, statement := range statements {
+		if err := execStatement(ctx, tx, statement); err != nil {
+			return fmt.Errorf("running statement %q: %w", statement, err)
+		}
+	}
+	return nil
+}
+
+// releaseIsolatedSchema hands the schema of an isolated binding user over to the data owner role, so that it outlives
+// the binding user like the objects reassigned to the data owner role do
+func releaseIsolatedSchema(ctx context.Context, tx transaction, cf connectionFactory, username string) error {
+	exists, err := schemaExists(ctx, tx, username)
+	if err != nil || !exists {
+		return err
+	}
+
+	if err := execStatement(ctx, tx, fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(cf.dataOwnerRole))); err != nil {
+		return fmt.Errorf("reassigning schema of binding user to data owner role: %w", err)
+	}
+	return nil
+}
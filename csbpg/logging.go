@@ -0,0 +1,82 @@
+package csbpg
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// logSubsystem is the tflog subsystem of the provider. Its level can be set on its own with TF_LOG_PROVIDER_CSBPG.
+const logSubsystem = "csbpg"
+
+const (
+	logFieldOperation = "operation"
+	logFieldUsername  = "username"
+	logFieldDatabase  = "database"
+	logFieldStatement = "statement"
+	logFieldDuration  = "duration"
+	logFieldError     = "error"
+)
+
+// logContext adds the csbpg subsystem logger to ctx. Every message logged through it carries the database of the
+// provider, and masks the secrets registered so far, so secrets must be registered before calling logContext.
+func (c connectionFactory) logContext(ctx context.Context) context.Context {
+	ctx = tflog.NewSubsystem(ctx, logSubsystem, tflog.WithLevelFromEnv("TF_LOG_PROVIDER", logSubsystem))
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, logFieldDatabase, c.database)
+	ctx = tflog.SubsystemMaskFieldValuesWithFieldKeys(ctx, logSubsystem, passwordKey)
+	return tflog.SubsystemMaskLogStrings(ctx, logSubsystem, c.secrets.list()...)
+}
+
+// loggingContextFunc logs the start and the end of a resource operation, with the binding username as a field of
+// every message logged during the operation
+func loggingContextFunc(operation string, f func(context.Context, *schema.ResourceData, any) diag.Diagnostics) func(context.Context, *schema.ResourceData, any) diag.Diagnostics {
+	return func(ctx context.Context, d *schema.ResourceData, m any) diag.Diagnostics {
+		ctx = m.(connectionFactory).logContext(ctx)
+		ctx = tflog.SubsystemSetField(ctx, logSubsystem, logFieldOperation, operation)
+		ctx = tflog.SubsystemSetField(ctx, logSubsystem, logFieldUsername, d.Get(bindingUsernameKey).(string))
+
+		tflog.SubsystemDebug(ctx, logSubsystem, "starting binding user operation")
+		start := time.Now()
+		diags := f(ctx, d, m)
+
+		fields := map[string]any{logFieldDuration: time.Since(start).String()}
+		if diags.HasError() {
+			tflog.SubsystemError(ctx, logSubsystem, "binding user operation failed", fields)
+		} else {
+			tflog.SubsystemDebug(ctx, logSubsystem, "finished binding user operation", fields)
+		}
+		return diags
+	}
+}
+
+// loggingStateContextFunc is loggingContextFunc for importers. The username is not known before the ID is parsed.
+func loggingStateContextFunc(f schema.StateContextFunc) schema.StateContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, m any) ([]*schema.ResourceData, error) {
+		ctx = m.(connectionFactory).logContext(ctx)
+		ctx = tflog.SubsystemSetField(ctx, logSubsystem, logFieldOperation, "import")
+
+		tflog.SubsystemDebug(ctx, logSubsystem, "starting binding user import", map[string]any{"id": d.Id()})
+		start := time.Now()
+		result, err := f(ctx, d, m)
+
+		fields := map[string]any{logFieldDuration: time.Since(start).String()}
+		if err != nil {
+			fields[logFieldError] = err.Error()
+			tflog.SubsystemError(ctx, logSubsystem, "binding user import failed", fields)
+		} else {
+			tflog.SubsystemDebug(ctx, logSubsystem, "finished binding user import", fields)
+		}
+		return result, err
+	}
+}
+
+// traceCall logs the entry into the named function, and its exit when the returned function is called
+func traceCall(ctx context.Context, name string) func() {
+	tflog.SubsystemTrace(ctx, logSubsystem, "ENTRY "+name)
+	return func() {
+		tflog.SubsystemTrace(ctx, logSubsystem, "EXIT "+name)
+	}
+}
@@ -0,0 +1,76 @@
+package csbpg
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("logging", func() {
+	var (
+		output  bytes.Buffer
+		ctx     context.Context
+		factory connectionFactory
+		d       *schema.ResourceData
+	)
+
+	BeforeEach(func() {
+		output.Reset()
+		ctx = tflogtest.RootLogger(context.TODO(), &output)
+		factory = connectionFactory{database: "testdb", secrets: newRedactor("admin-password")}
+		d = schema.TestResourceDataRaw(GinkgoT(), resourceBindingUser().Schema, map[string]any{
+			bindingUsernameKey: "someuser",
+			bindingPasswordKey: "binding-password",
+		})
+	})
+
+	logEntries := func() []map[string]any {
+		entries, err := tflogtest.MultilineJSONDecode(&output)
+		Expect(err).NotTo(HaveOccurred())
+		return entries
+	}
+
+	It("logs resource operations in the csbpg subsystem with the binding and database as fields", func() {
+		f := redactingContextFunc(loggingContextFunc("create", func(ctx context.Context, _ *schema.ResourceData, _ any) diag.Diagnostics {
+			tflog.SubsystemDebug(ctx, logSubsystem, "working")
+			return nil
+		}))
+		Expect(f(ctx, d, factory)).To(BeEmpty())
+
+		entries := logEntries()
+		Expect(entries).To(HaveLen(3))
+		for _, entry := range entries {
+			Expect(entry).To(HaveKeyWithValue("@module", "provider.csbpg"))
+			Expect(entry).To(HaveKeyWithValue(logFieldOperation, "create"))
+			Expect(entry).To(HaveKeyWithValue(logFieldUsername, "someuser"))
+			Expect(entry).To(HaveKeyWithValue(logFieldDatabase, "testdb"))
+		}
+		Expect(entries[1]).To(HaveKeyWithValue("@message", "working"))
+		Expect(entries[2]).To(HaveKey(logFieldDuration))
+	})
+
+	It("masks secrets in messages and fields", func() {
+		f := redactingContextFunc(loggingContextFunc("update", func(ctx context.Context, _ *schema.ResourceData, _ any) diag.Diagnostics {
+			tflog.SubsystemDebug(ctx, logSubsystem, "using admin-password", map[string]any{
+				logFieldStatement: "ALTER ROLE someuser WITH PASSWORD 'binding-password'",
+				passwordKey:       "anything",
+			})
+			return diag.Errorf("failed")
+		}))
+		Expect(f(ctx, d, factory)).To(HaveLen(1))
+
+		Expect(output.String()).NotTo(ContainSubstring("admin-password"))
+		Expect(output.String()).NotTo(ContainSubstring("binding-password"))
+		Expect(output.String()).NotTo(ContainSubstring("anything"))
+
+		entries := logEntries()
+		Expect(entries[1]).To(HaveKeyWithValue(logFieldStatement, "ALTER ROLE someuser WITH PASSWORD '***'"))
+		Expect(entries[2]).To(HaveKeyWithValue("@level", "error"))
+	})
+})
@@ -0,0 +1,193 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/lib/pq"
+)
+
+// dependency is an entry of pg_shdepend that refers to a role, described by pg_describe_object
+type dependency struct {
+	deptype string
+	object  string
+}
+
+// cleanUp describes what dropping the dependencies of a binding user does to this one
+func (d dependency) cleanUp(cf connectionFactory, opts bindingUserOptions) string {
+	switch d.deptype {
+	case "o":
+		if opts.onDeleteOwnedObjects == onDeleteOwnedObjectsDrop {
+			return fmt.Sprintf("dropped %s", d.object)
+		}
+		return fmt.Sprintf("reassigned %s to %q", d.object, cf.dataOwnerRole)
+	case "r":
+		return fmt.Sprintf("removed from %s", d.object)
+	default:
+		return fmt.Sprintf("revoked privileges on %s", d.object)
+	}
+}
+
+// cleanUpOtherDatabases removes what a binding user has in the databases of the server other than the one of the
+// provider, so that the role can be dropped. The objects it owns are dealt with according to on_delete_owned_objects
+// and the privileges granted to it are revoked. Each database is cleaned up in a transaction of its own, and the
+// warning returned lists what has been cleaned up.
+func cleanUpOtherDatabases(ctx context.Context, cf connectionFactory, username string, opts bindingUserOptions) diag.Diagnostics {
+	db, err := cf.AdminPool()
+	if err != nil {
+		return diag.Errorf("connecting as admin: %s", err)
+	}
+
+	databases, err := databasesWithDependencies(ctx, db, username)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var report []string
+	for _, database := range databases {
+		cleanedUp, err := cleanUpDatabase(ctx, cf, database, username, opts)
+		var owned *ownedObjectsError
+		switch {
+		case errors.As(err, &owned):
+			return diag.Diagnostics{owned.diagnostic()}
+		case err != nil:
+			return diag.Errorf("cleaning up binding user %q in database %q: %s", username, database, err)
+		}
+		report = append(report, fmt.Sprintf("database %q:\n    - %s", database, strings.Join(cleanedUp, "\n    - ")))
+	}
+
+	if len(report) == 0 {
+		return nil
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  "Cleaned up binding user in other databases",
+		Detail:   fmt.Sprintf("Binding user %q had dependencies in other databases of the server, which have been cleaned up:\n  %s", username, strings.Join(report, "\n  ")),
+	}}
+}
+
+func cleanUpDatabase(ctx context.Context, cf connectionFactory, database, username string, opts bindingUserOptions) ([]string, error) {
+	ctx = tflog.SubsystemSetField(ctx, logSubsystem, logFieldDatabase, database)
+
+	other := cf.forDatabase(database)
+	defer func() {
+		_ = other.Close()
+	}()
+
+	var cleanedUp []string
+	audit := newAuditTrail(cf, auditOperationCleanUpDatabase, username)
+	err := runTransaction(ctx, other, func(tx *sql.Tx) error {
+		audited := audit.wrap(tx)
+		audit.statements = append(audit.statements, fmt.Sprintf(`\connect %s`, pq.QuoteIdentifier(database)))
+
+		dependencies, err := listDependencies(ctx, tx, username)
+		if err != nil {
+			return err
+		}
+
+		var owned []string
+		cleanedUp = nil
+		for _, d := range dependencies {
+			if d.deptype == "o" {
+				owned = append(owned, fmt.Sprintf("%s in database %q", d.object, database))
+			}
+			cleanedUp = append(cleanedUp, d.cleanUp(cf, opts))
+		}
+		if opts.onDeleteOwnedObjects == onDeleteOwnedObjectsFail && len(owned) > 0 {
+			return &ownedObjectsError{username: username, objects: owned}
+		}
+
+		statements := []string{
+			fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(cf.username)),
+		}
+		if opts.onDeleteOwnedObjects != onDeleteOwnedObjectsDrop {
+			statements = append(statements,
+				fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(username)),
+				fmt.Sprintf("REASSIGN OWNED BY CURRENT_USER TO %s", pq.QuoteIdentifier(cf.dataOwnerRole)),
+				fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(cf.username)),
+			)
+		}
+		// Once the objects have been reassigned, only the privileges are left to drop
+		statements = append(statements, fmt.Sprintf("DROP OWNED BY %s", pq.QuoteIdentifier(username)))
+
+		for _, statement := range statements {
+			if err := execStatement(ctx, audited, statement); err != nil {
+				return fmt.Errorf("running statement %q: %w", statement, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		audit.recordFailure(ctx, err)
+		return nil, err
+	}
+	audit.recordSuccessInOwnTransaction(ctx)
+
+	return cleanedUp, nil
+}
+
+// databasesWithDependencies lists the databases, other than the current one, that have objects depending on a role
+func databasesWithDependencies(ctx context.Context, q querier, username string) ([]string, error) {
+	defer traceCall(ctx, "databasesWithDependencies")()
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT DISTINCT db.datname
+		FROM pg_catalog.pg_shdepend d
+		JOIN pg_catalog.pg_roles r ON r.oid = d.refobjid
+		JOIN pg_catalog.pg_database db ON db.oid = d.dbid
+		WHERE d.refclassid = 'pg_catalog.pg_authid'::pg_catalog.regclass
+		AND r.rolname = $1
+		AND db.datname <> pg_catalog.current_database()
+		ORDER BY 1`, username)
+	if err != nil {
+		return nil, fmt.Errorf("listing databases with objects depending on %q: %w", username, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var databases []string
+	for rows.Next() {
+		var database string
+		if err := rows.Scan(&database); err != nil {
+			return nil, fmt.Errorf("listing databases with objects depending on %q: %w", username, err)
+		}
+		databases = append(databases, database)
+	}
+	return databases, rows.Err()
+}
+
+// listDependencies describes the objects of the current database that depend on a role
+func listDependencies(ctx context.Context, q querier, username string) ([]dependency, error) {
+	defer traceCall(ctx, "listDependencies")()
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT d.deptype, pg_catalog.pg_describe_object(d.classid, d.objid, d.objsubid)
+		FROM pg_catalog.pg_shdepend d
+		JOIN pg_catalog.pg_roles r ON r.oid = d.refobjid
+		WHERE d.refclassid = 'pg_catalog.pg_authid'::pg_catalog.regclass
+		AND r.rolname = $1
+		AND d.dbid = (SELECT oid FROM pg_catalog.pg_database WHERE datname = pg_catalog.current_database())
+		ORDER BY 2, 1`, username)
+	if err != nil {
+		return nil, fmt.Errorf("listing objects depending on %q: %w", username, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var dependencies []dependency
+	for rows.Next() {
+		var d dependency
+		if err := rows.Scan(&d.deptype, &d.object); err != nil {
+			return nil, fmt.Errorf("listing objects depending on %q: %w", username, err)
+		}
+		dependencies = append(dependencies, d)
+	}
+	return dependencies, rows.Err()
+}
@@ -0,0 +1,132 @@
+package csbpg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+const (
+	onDeleteOwnedObjectsReassign = "reassign"
+	onDeleteOwnedObjectsDrop     = "drop"
+	onDeleteOwnedObjectsFail     = "fail"
+)
+
+// ownedObjectsError is returned when a binding user cannot be deleted because it still owns objects
+type ownedObjectsError struct {
+	username string
+	objects  []string
+}
+
+func (e *ownedObjectsError) Error() string {
+	return fmt.Sprintf("binding user %q still owns %d objects: %s", e.username, len(e.objects), strings.Join(e.objects, ", "))
+}
+
+func (e *ownedObjectsError) diagnostic() diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity: diag.Error,
+		Summary:  "Binding user still owns objects",
+		Detail: fmt.Sprintf(
+			"Binding user %q cannot be deleted because on_delete_owned_objects is %q and it owns:\n  - %s\nDrop the objects or reassign them to another role, or change on_delete_owned_objects.",
+			e.username, onDeleteOwnedObjectsFail, strings.Join(e.objects, "\n  - "),
+		),
+	}
+}
+
+// checkOwnedObjects returns an ownedObjectsError when a binding user owns objects in any database of the server, so
+// that on_delete_owned_objects = "fail" refuses the deletion before sessions are ended or other databases cleaned up.
+// The schema of a binding user isolated in a schema of its own does not count, as the deletion releases it.
+func checkOwnedObjects(ctx context.Context, cf connectionFactory, username string, opts bindingUserOptions) error {
+	defer traceCall(ctx, "checkOwnedObjects")()
+
+	db, err := cf.AdminPool()
+	if err != nil {
+		return fmt.Errorf("connecting as admin: %w", err)
+	}
+
+	var isolatedSchema string
+	if opts.isolation == isolationSchema {
+		isolatedSchema = username
+	}
+	objects, err := listOwnedObjects(ctx, db, username, isolatedSchema)
+	if err != nil {
+		return err
+	}
+
+	databases, err := databasesWithDependencies(ctx, db, username)
+	if err != nil {
+		return err
+	}
+	for _, database := range databases {
+		owned, err := listOwnedObjectsInDatabase(ctx, cf, database, username)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, owned...)
+	}
+
+	if len(objects) > 0 {
+		return &ownedObjectsError{username: username, objects: objects}
+	}
+	return nil
+}
+
+// listOwnedObjectsInDatabase describes the objects owned by a role in another database of the server
+func listOwnedObjectsInDatabase(ctx context.Context, cf connectionFactory, database, username string) ([]string, error) {
+	other := cf.forDatabase(database)
+	defer func() {
+		_ = other.Close()
+	}()
+
+	db, err := other.AdminPool()
+	if err != nil {
+		return nil, fmt.Errorf("connecting as admin to database %q: %w", database, err)
+	}
+	dependencies, err := listDependencies(ctx, db, username)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []string
+	for _, d := range dependencies {
+		if d.deptype == "o" {
+			objects = append(objects, fmt.Sprintf("%s in database %q", d.object, database))
+		}
+	}
+	return objects, nil
+}
+
+// listOwnedObjects describes the objects owned by a role in the current database, and the shared objects it owns,
+// other than the schema named excludedSchema when not empty
+func listOwnedObjects(ctx context.Context, q querier, username, excludedSchema string) ([]string, error) {
+	defer traceCall(ctx, "listOwnedObjects")()
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT pg_catalog.pg_describe_object(d.classid, d.objid, d.objsubid)
+		FROM pg_catalog.pg_shdepend d
+		JOIN pg_catalog.pg_roles r ON r.oid = d.refobjid
+		WHERE d.refclassid = 'pg_catalog.pg_authid'::pg_catalog.regclass
+		AND d.deptype = 'o'
+		AND r.rolname = $1
+		AND d.dbid IN (0, (SELECT oid FROM pg_catalog.pg_database WHERE datname = pg_catalog.current_database()))
+		AND (d.classid <> 'pg_catalog.pg_namespace'::pg_catalog.regclass OR d.objid NOT IN (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname = $2))
+		ORDER BY 1`, username, excludedSchema)
+	if err != nil {
+		return nil, fmt.Errorf("listing objects owned by %q: %w", username, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var objects []string
+	for rows.Next() {
+		var object string
+		if err := rows.Scan(&object); err != nil {
+			return nil, fmt.Errorf("listing objects owned by %q: %w", username, err)
+		}
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
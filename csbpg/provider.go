@@ -3,7 +3,10 @@ package csbpg
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
@@ -11,16 +14,37 @@ import (
 
 const (
 	dataOwnerRoleKey = "data_owner_role"
-	databaseKey      = "database"
-	passwordKey      = "password"
-	usernameKey      = "username"
-	portKey          = "port"
-	hostKey          = "host"
-	sslModeKey       = "sslmode"
-	clientCertKey    = "clientcert"
-	sslRootCertKey   = "sslrootcert"
+	readerRoleKey    = "reader_role"
+	schemasKey       = "schemas"
+
+	revokePublicAccessKey = "revoke_public_access"
+	databaseKey           = "database"
+	passwordKey           = "password"
+	usernameKey           = "username"
+	portKey               = "port"
+	hostKey               = "host"
+	sslModeKey            = "sslmode"
+	clientCertKey         = "clientcert"
+	sslRootCertKey        = "sslrootcert"
+	lockTimeoutKey        = "lock_timeout"
+	maxRetriesKey         = "max_retries"
+
+	maxOpenConnectionsKey = "max_open_connections"
+	maxIdleConnectionsKey = "max_idle_connections"
+	connMaxLifetimeKey    = "conn_max_lifetime"
+
+	skipConnectionCheckKey = "skip_connection_check"
+
+	previewStatementsKey = "preview_statements"
+	auditSchemaKey       = "audit_schema"
+
+	passwordMinLengthKey           = "password_min_length"
+	passwordForbiddenCharactersKey = "password_forbidden_characters"
 )
 
+// Version is the version of the provider recorded in the audit log. Release builds set it from main.
+var Version = "dev"
+
 func Provider() *schema.Provider {
 	return &schema.Provider{
 		Schema: map[string]*schema.Schema{
@@ -50,6 +74,27 @@ func Provider() *schema.Provider {
 				Type:     schema.TypeString,
 				Required: true,
 			},
+			readerRoleKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringLenBetween(1, maxIdentifierLength),
+				Description:  "Role of which read-only binding users are members. Created when missing. Defaults to the data owner role followed by \"_reader\".",
+			},
+			schemasKey: {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringLenBetween(1, maxIdentifierLength),
+				},
+				Description: "Schemas in which binding users get ownership, grants and default privileges. Missing schemas are created. Defaults to [\"public\"].",
+			},
+			revokePublicAccessKey: {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Grant the schemas and the tables of binding users to the data owner role instead of PUBLIC, and revoke the privileges of PUBLIC on the schemas and their tables when a read-only binding user is created. Required by read-only binding users. Affects every role of the database.",
+			},
 			sslModeKey: {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -81,6 +126,72 @@ func Provider() *schema.Provider {
 				Description: "The SSL server root, must contain PEM encoded data.",
 				Optional:    true,
 			},
+			lockTimeoutKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "5m",
+				ValidateFunc: validateDuration,
+				Description:  "Maximum time to wait for concurrent binding operations on the same database to finish, e.g. \"30s\". Zero waits until the resource timeout expires.",
+			},
+			maxRetriesKey: {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      3,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Number of times a binding operation is retried after a transient error such as a serialization failure, a deadlock or a dropped connection.",
+			},
+			maxOpenConnectionsKey: {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      5,
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Maximum number of open connections in the admin connection pool shared by all resources.",
+			},
+			maxIdleConnectionsKey: {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      2,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Maximum number of idle connections kept in the admin connection pool.",
+			},
+			connMaxLifetimeKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "10m",
+				ValidateFunc: validateDuration,
+				Description:  "Maximum time a connection in the admin connection pool may be reused, e.g. \"10m\". Zero reuses connections forever.",
+			},
+			skipConnectionCheckKey: {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Do not connect to the server when the provider is configured. Useful when the server is created in the same apply.",
+			},
+			previewStatementsKey: {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Inspect the catalog when planning binding users and show the statements that applying the plan would run in their planned_statements attribute.",
+			},
+			auditSchemaKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringLenBetween(1, maxIdentifierLength),
+				Description:  "Schema in which binding user operations are recorded, in the csbpg_audit_log table. The schema and the table are created when needed. Operations are not recorded when unset.",
+			},
+			passwordMinLengthKey: {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      0,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Minimum number of characters of binding user passwords. Zero disables the check.",
+			},
+			passwordForbiddenCharactersKey: {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: "Characters that binding user passwords must not contain.",
+			},
 		},
 		ConfigureContextFunc: providerConfigure,
 		ResourcesMap: map[string]*schema.Resource{
@@ -89,18 +200,58 @@ func Provider() *schema.Provider {
 	}
 }
 
-func providerConfigure(_ context.Context, d *schema.ResourceData) (any, diag.Diagnostics) {
+func providerConfigure(ctx context.Context, d *schema.ResourceData) (any, diag.Diagnostics) {
 	var diags diag.Diagnostics
 
 	factory := connectionFactory{
-		host:          d.Get(hostKey).(string),
-		port:          d.Get(portKey).(int),
-		username:      d.Get(usernameKey).(string),
-		password:      d.Get(passwordKey).(string),
-		database:      d.Get(databaseKey).(string),
-		dataOwnerRole: d.Get(dataOwnerRoleKey).(string),
-		sslMode:       d.Get(sslModeKey).(string),
-		sslRootCert:   d.Get(sslRootCertKey).(string),
+		host:               d.Get(hostKey).(string),
+		port:               d.Get(portKey).(int),
+		username:           d.Get(usernameKey).(string),
+		password:           d.Get(passwordKey).(string),
+		database:           d.Get(databaseKey).(string),
+		dataOwnerRole:      d.Get(dataOwnerRoleKey).(string),
+		readerRole:         d.Get(readerRoleKey).(string),
+		schemas:            []string{defaultSchema},
+		revokePublicAccess: d.Get(revokePublicAccessKey).(bool),
+		sslMode:            d.Get(sslModeKey).(string),
+		sslRootCert:        d.Get(sslRootCertKey).(string),
+		maxRetries:         d.Get(maxRetriesKey).(int),
+		previewStatements:  d.Get(previewStatementsKey).(bool),
+		auditSchema:        d.Get(auditSchemaKey).(string),
+		pool: poolConfig{
+			maxOpenConnections: d.Get(maxOpenConnectionsKey).(int),
+			maxIdleConnections: d.Get(maxIdleConnectionsKey).(int),
+		},
+		passwordPolicy: passwordPolicy{
+			minLength:           d.Get(passwordMinLengthKey).(int),
+			forbiddenCharacters: d.Get(passwordForbiddenCharactersKey).(string),
+		},
+		admin:   &adminPool{},
+		secrets: newRedactor(d.Get(passwordKey).(string)),
+	}
+
+	// The values have already been checked by validateDuration
+	factory.lockTimeout, _ = time.ParseDuration(d.Get(lockTimeoutKey).(string))
+	factory.pool.connMaxLifetime, _ = time.ParseDuration(d.Get(connMaxLifetimeKey).(string))
+
+	if factory.readerRole == "" {
+		factory.readerRole = factory.dataOwnerRole + readerRoleSuffix
+		// PostgreSQL would truncate the name, so that the reader role would never be found once created
+		if factory.revokePublicAccess && len(factory.readerRole) > maxIdentifierLength {
+			return nil, diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Reader role name is too long",
+				Detail:        fmt.Sprintf("The reader role defaults to %q, which is longer than %d bytes. Set reader_role in the provider configuration.", factory.readerRole, maxIdentifierLength),
+				AttributePath: cty.GetAttrPath(readerRoleKey),
+			}}
+		}
+	}
+
+	if value, ok := d.GetOk(schemasKey); ok {
+		factory.schemas = nil
+		for _, schema := range value.([]any) {
+			factory.schemas = append(factory.schemas, schema.(string))
+		}
 	}
 
 	if value, ok := d.GetOk(clientCertKey); ok {
@@ -109,8 +260,37 @@ func providerConfigure(_ context.Context, d *schema.ResourceData) (any, diag.Dia
 				Certificate: spec["cert"].(string),
 				Key:         spec["key"].(string),
 			}
+			factory.secrets.add(factory.sslClientCert.Key)
 		}
 	}
 
-	return factory, diags
+	if !d.Get(skipConnectionCheckKey).(bool) {
+		diags = append(diags, checkConnection(factory.logContext(ctx), factory)...)
+	}
+
+	// Terraform cancels the stop context when it asks the provider to stop
+	if stopCtx, ok := schema.StopContext(ctx); ok {
+		go func() {
+			<-stopCtx.Done()
+			_ = factory.Close()
+		}()
+	}
+
+	return factory, factory.secrets.redactDiagnostics(diags)
+}
+
+func validateDuration(i any, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %q to be string", k)}
+	}
+
+	d, err := time.ParseDuration(v)
+	switch {
+	case err != nil:
+		return nil, []error{fmt.Errorf("expected %q to be a duration such as \"30s\", got %q", k, v)}
+	case d < 0:
+		return nil, []error{fmt.Errorf("expected %q to not be negative, got %q", k, v)}
+	}
+	return nil, nil
 }
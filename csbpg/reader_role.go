@@ -0,0 +1,137 @@
+package csbpg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/lib/pq"
+)
+
+const (
+	accessReadWrite = "read_write"
+	accessReadOnly  = "read_only"
+
+	// readerRoleSuffix makes the default reader role name out of the data owner role name
+	readerRoleSuffix = "_reader"
+)
+
+// accessRole is the role that binding users with the given access are members of
+func (c connectionFactory) accessRole(access string) string {
+	if access == accessReadOnly {
+		return c.readerRole
+	}
+	return c.dataOwnerRole
+}
+
+// sharedGrantee is the grantee of the schemas and of the tables that read-write binding users create. It is PUBLIC, as
+// in earlier versions, unless the provider revokes the access of PUBLIC for the sake of read-only binding users.
+func (c connectionFactory) sharedGrantee() string {
+	if c.revokePublicAccess {
+		return pq.QuoteIdentifier(c.dataOwnerRole)
+	}
+	return "PUBLIC"
+}
+
+// createReaderRole creates the role of read-only binding users if missing, and lets it read the existing tables and
+// sequences of the schemas. The tables created later are granted to it by the default privileges of the read-write
+// binding users. The role is only in use when the provider revokes the access of PUBLIC, which read-only binding users
+// require, or when it exists already; otherwise nothing is done. The boolean result tells whether it is in use.
+func createReaderRole(ctx context.Context, tx transaction, cf connectionFactory) (bool, error) {
+	defer traceCall(ctx, "createReaderRole")()
+
+	exists, err := roleExists(ctx, tx, cf.readerRole)
+	switch {
+	case err != nil:
+		return false, fmt.Errorf("checking whether reader role exists: %w", err)
+	case !exists && !cf.revokePublicAccess:
+		return false, nil
+	}
+
+	if !exists {
+		tflog.SubsystemDebug(ctx, logSubsystem, "reader role does not exist - creating")
+		if err := execStatement(ctx, tx, fmt.Sprintf("CREATE ROLE %s WITH NOLOGIN", pq.QuoteIdentifier(cf.readerRole))); err != nil {
+			return false, fmt.Errorf("creating reader role: %w", err)
+		}
+	}
+
+	tflog.SubsystemDebug(ctx, logSubsystem, "granting reader role")
+	schemas := quoteIdentifiers(cf.schemas)
+	statements := []string{
+		fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", pq.QuoteIdentifier(cf.database), pq.QuoteIdentifier(cf.readerRole)),
+		fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", schemas, pq.QuoteIdentifier(cf.readerRole)),
+		fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s", schemas, pq.QuoteIdentifier(cf.readerRole)),
+		fmt.Sprintf("GRANT SELECT ON ALL SEQUENCES IN SCHEMA %s TO %s", schemas, pq.QuoteIdentifier(cf.readerRole)),
+	}
+	for _, statement := range statements {
+		if err := execStatement(ctx, tx, statement); err != nil {
+			return false, fmt.Errorf("running statement %q: %w", statement, err)
+		}
+	}
+
+	return true, nil
+}
+
+// revokePublicAccess withdraws from PUBLIC the privileges on the schemas and their tables that the provider grants to
+// it without revoke_public_access, as read-only binding users would otherwise get them too. This affects every role of
+// the database, not only binding users, hence the opt-in. Read-write binding users keep their access through the data
+// owner role, and their default privileges are moved from PUBLIC to the data owner role.
+func revokePublicAccess(ctx context.Context, tx transaction, cf connectionFactory) error {
+	defer traceCall(ctx, "revokePublicAccess")()
+
+	members, err := listAccessRoleMembers(ctx, tx, cf.dataOwnerRole)
+	if err != nil {
+		return err
+	}
+
+	schemas := quoteIdentifiers(cf.schemas)
+	statements := []string{
+		fmt.Sprintf("REVOKE ALL ON SCHEMA %s FROM PUBLIC", schemas),
+		fmt.Sprintf("REVOKE ALL ON ALL TABLES IN SCHEMA %s FROM PUBLIC", schemas),
+	}
+	for _, member := range members {
+		statements = append(statements, fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s REVOKE ALL ON TABLES FROM PUBLIC", pq.QuoteIdentifier(member), schemas))
+	}
+	for _, statement := range statements {
+		if err := execStatement(ctx, tx, statement); err != nil {
+			return fmt.Errorf("running statement %q: %w", statement, err)
+		}
+	}
+
+	for _, member := range members {
+		if err := grantDefaultPrivilegesOnObjectsCreatedBy(ctx, tx, cf, member, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listAccessRoleMembers lists the direct members of a role whose default privileges the admin user can alter
+func listAccessRoleMembers(ctx context.Context, q querier, role string) ([]string, error) {
+	defer traceCall(ctx, "listAccessRoleMembers")()
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT r.rolname
+		FROM pg_catalog.pg_auth_members m
+		JOIN pg_catalog.pg_roles g ON g.oid = m.roleid
+		JOIN pg_catalog.pg_roles r ON r.oid = m.member
+		WHERE g.rolname = $1
+		AND pg_catalog.pg_has_role(current_user, r.oid, 'MEMBER')
+		ORDER BY 1`, role)
+	if err != nil {
+		return nil, fmt.Errorf("listing members of role %q: %w", role, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var members []string
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return nil, fmt.Errorf("listing members of role %q: %w", role, err)
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
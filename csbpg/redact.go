@@ -0,0 +1,110 @@
+package csbpg
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const redacted = "REDACTED"
+
+// redactor masks every secret the provider has seen, so that none of them end up in diagnostics or logs.
+// It is shared by every copy of the connectionFactory of a provider instance.
+type redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+func newRedactor(secrets ...string) *redactor {
+	r := &redactor{}
+	r.add(secrets...)
+	return r
+}
+
+// add registers secrets. Besides the secrets themselves, the forms in which they can appear in error messages are
+// registered too: quoted as SQL literals, escaped in connection strings, and escaped by %q.
+func (r *redactor) add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range secrets {
+		if s == "" {
+			continue
+		}
+		for _, form := range []string{
+			s,
+			strings.ReplaceAll(s, "'", "''"),
+			strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", "''"),
+			dsnValueEscaper.Replace(s),
+		} {
+			quoted := strconv.Quote(form)
+			for _, f := range []string{form, quoted[1 : len(quoted)-1]} {
+				if !slices.Contains(r.secrets, f) {
+					r.secrets = append(r.secrets, f)
+				}
+			}
+		}
+	}
+
+	// Longer secrets first, so that a secret containing another one is masked as a whole
+	slices.SortStableFunc(r.secrets, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+}
+
+func (r *redactor) list() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.secrets)
+}
+
+func (r *redactor) redact(s string) string {
+	for _, secret := range r.list() {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+func (r *redactor) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.New(r.redact(err.Error()))
+}
+
+func (r *redactor) redactDiagnostics(diags diag.Diagnostics) diag.Diagnostics {
+	for i := range diags {
+		diags[i].Summary = r.redact(diags[i].Summary)
+		diags[i].Detail = r.redact(diags[i].Detail)
+	}
+	return diags
+}
+
+// redactingContextFunc registers the binding passwords of the resource, before and after the change, as secrets
+// and masks every known secret in the diagnostics returned by f
+func redactingContextFunc(f func(context.Context, *schema.ResourceData, any) diag.Diagnostics) func(context.Context, *schema.ResourceData, any) diag.Diagnostics {
+	return func(ctx context.Context, d *schema.ResourceData, m any) diag.Diagnostics {
+		cf := m.(connectionFactory)
+		registerBindingPasswords(d, cf)
+		return cf.secrets.redactDiagnostics(f(ctx, d, m))
+	}
+}
+
+// redactingStateContextFunc masks every known secret in the error returned by the importer f
+func redactingStateContextFunc(f schema.StateContextFunc) schema.StateContextFunc {
+	return func(ctx context.Context, d *schema.ResourceData, m any) ([]*schema.ResourceData, error) {
+		cf := m.(connectionFactory)
+		result, err := f(ctx, d, m)
+		return result, cf.secrets.redactError(err)
+	}
+}
+
+func registerBindingPasswords(d *schema.ResourceData, cf connectionFactory) {
+	before, after := d.GetChange(bindingPasswordKey)
+	cf.secrets.add(before.(string), after.(string))
+}
@@ -3,117 +3,262 @@ package csbpg
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
-	"sync"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/lib/pq"
 )
 
 const (
-	bindingUsernameKey       = "username"
-	bindingPasswordKey       = "password"
-	legacyBrokerBindingGroup = "binding_group"
+	bindingUsernameKey          = "username"
+	bindingPasswordKey          = "password"
+	keepExistingPasswordKey     = "keep_existing_password"
+	accessRoleMemberKey         = "access_role_member"
+	loginEnabledKey             = "login_enabled"
+	defaultPrivilegesGrantedKey = "default_privileges_granted"
+
+	sessionTerminationKey            = "session_termination"
+	sessionTerminationGracePeriodKey = "session_termination_grace_period"
+	onDeleteOwnedObjectsKey          = "on_delete_owned_objects"
+	isolationKey                     = "isolation"
+	isolatedSchemaKey                = "schema"
+	accessKey                        = "access"
+	legacyBrokerBindingGroup         = "binding_group"
 )
 
-var (
-	createBindingMutex sync.Mutex
-	deleteBindingMutex sync.Mutex
-)
+var driftKeys = []string{accessRoleMemberKey, loginEnabledKey, defaultPrivilegesGrantedKey}
+
+// repairKeys are the attributes whose planned change is applied by repairing the binding user
+var repairKeys = append([]string{isolatedSchemaKey}, driftKeys...)
 
 func resourceBindingUser() *schema.Resource {
 	return &schema.Resource{
 		Schema: map[string]*schema.Schema{
 			bindingUsernameKey: {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:             schema.TypeString,
+				Required:         true,
+				ForceNew:         true,
+				ValidateDiagFunc: validateBindingUsername,
 			},
 			bindingPasswordKey: {
 				Type:      schema.TypeString,
 				Required:  true,
 				Sensitive: true,
 			},
+			keepExistingPasswordKey: {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "When adopting a pre-existing role, keep its password instead of setting the configured one. Only takes effect on creation.",
+			},
+			sessionTerminationKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      sessionTerminationNone,
+				ValidateFunc: validation.StringInSlice([]string{sessionTerminationNone, sessionTerminationWait, sessionTerminationTerminate}, false),
+				Description:  "What to do with the open sessions of the binding user when it is deleted. \"none\" drops the role regardless. \"wait\" revokes LOGIN and waits for the sessions to end, failing if some are still open after the grace period. \"terminate\" revokes LOGIN and terminates the sessions still open after the grace period.",
+			},
+			sessionTerminationGracePeriodKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "30s",
+				ValidateFunc: validateDuration,
+				Description:  "How long the open sessions of the binding user are given to end by themselves when it is deleted, e.g. \"30s\".",
+			},
+			onDeleteOwnedObjectsKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      onDeleteOwnedObjectsReassign,
+				ValidateFunc: validation.StringInSlice([]string{onDeleteOwnedObjectsReassign, onDeleteOwnedObjectsDrop, onDeleteOwnedObjectsFail}, false),
+				Description:  "What to do with the objects owned by the binding user when it is deleted. \"reassign\" hands them over to the data owner role, \"drop\" drops them, and \"fail\" refuses to delete the binding user while it owns any.",
+			},
+			accessKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      accessReadWrite,
+				ValidateFunc: validation.StringInSlice([]string{accessReadWrite, accessReadOnly}, false),
+				Description:  "What the binding user can do with the data. \"read_write\" makes it a member of the data owner role. \"read_only\" makes it a member of the reader role, which can only read the tables and sequences of the schemas.",
+			},
+			isolationKey: {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      isolationShared,
+				ValidateFunc: validation.StringInSlice([]string{isolationShared, isolationSchema}, false),
+				Description:  "How the binding user is isolated from other bindings. \"shared\" uses the schemas of the provider. \"schema\" gives it a schema of its own, named after it, as its search_path.",
+			},
+			isolatedSchemaKey: {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Schema of the binding user when isolation is \"schema\", empty otherwise.",
+			},
+			accessRoleMemberKey: {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the binding user is a direct member of the role of its access: the data owner role, or the reader role for read-only binding users.",
+			},
+			loginEnabledKey: {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the binding user has the LOGIN attribute.",
+			},
+			defaultPrivilegesGrantedKey: {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the tables, sequences, functions and types created by the binding user are granted by default to the data owner role, its tables and sequences to the reader role, and its tables to PUBLIC unless revoke_public_access is set. Always true for read-only binding users.",
+			},
+			plannedStatementsKey: {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Statements that the last plan expected to run, when the provider is configured with preview_statements. Passwords are replaced by a placeholder.",
+			},
+		},
+		CustomizeDiff: customdiff.All(validateBindingUserDiff, resourceBindingUserCustomizeDiff, resourceBindingUserPlanStatements),
+		CreateContext: redactingContextFunc(loggingContextFunc("create", resourceBindingUserCreate)),
+		ReadContext:   redactingContextFunc(loggingContextFunc("read", resourceBindingUserRead)),
+		UpdateContext: redactingContextFunc(loggingContextFunc("update", resourceBindingUserUpdate)),
+		DeleteContext: redactingContextFunc(loggingContextFunc("delete", resourceBindingUserDelete)),
+		Importer: &schema.ResourceImporter{
+			StateContext: redactingStateContextFunc(loggingStateContextFunc(resourceBindingUserImport)),
+		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{{
+			Version: 0,
+			Type:    resourceBindingUserV0().CoreConfigSchema().ImpliedType(),
+			Upgrade: upgradeBindingUserStateV0,
+		}},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Read:   schema.DefaultTimeout(2 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
 		},
-		CreateContext: resourceBindingUserCreate,
-		ReadContext:   resourceBindingUserRead,
-		UpdateContext: resourceBindingUserUpdate,
-		DeleteContext: resourceBindingUserDelete,
 		Description:   "Represents a CloudFoundry binding in PostgreSQL",
 		UseJSONNumber: true,
 	}
 }
 
 func resourceBindingUserCreate(ctx context.Context, d *schema.ResourceData, m any) diag.Diagnostics {
-	createBindingMutex.Lock()
-	defer createBindingMutex.Unlock()
-
-	log.Println("[DEBUG] ENTRY resourceBindingUserCreate()")
-	defer log.Println("[DEBUG] EXIT resourceBindingUserCreate()")
+	defer traceCall(ctx, "resourceBindingUserCreate")()
 
 	username := d.Get(bindingUsernameKey).(string)
 	password := d.Get(bindingPasswordKey).(string)
-	err := sqlUserCreate(ctx, username, password, m)
-	if err != nil {
-		return err
+	diags := sqlUserCreate(ctx, username, password, bindingUserOptionsFromResourceData(d), m)
+	if diags.HasError() {
+		return diags
 	}
+	tflog.SubsystemDebug(ctx, logSubsystem, "setting ID")
 	d.SetId(username)
-	return nil
+	return append(diags, resourceBindingUserRead(ctx, d, m)...)
 }
 
-func sqlUserCreate(ctx context.Context, username, password string, m any) diag.Diagnostics {
-	cf := m.(connectionFactory)
+// bindingUserOptions holds the per-binding settings that change how a binding user is created or deleted.
+type bindingUserOptions struct {
+	keepExistingPassword          bool
+	sessionTermination            string
+	sessionTerminationGracePeriod time.Duration
+	onDeleteOwnedObjects          string
+	isolation                     string
+	access                        string
+}
 
-	db, err := cf.ConnectAsAdmin()
-	if err != nil {
-		return diag.Errorf("connecting as admin: %s", err)
-	}
-	defer func() {
-		_ = db.Close()
-	}()
+// resourceGetter is implemented by both schema.ResourceData and schema.ResourceDiff
+type resourceGetter interface {
+	Get(key string) any
+}
 
-	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return diag.Errorf("starting transaction: %s", err)
+func bindingUserOptionsFromResourceData(d resourceGetter) bindingUserOptions {
+	// The grace period has already been checked by validateDuration
+	gracePeriod, _ := time.ParseDuration(d.Get(sessionTerminationGracePeriodKey).(string))
+
+	return bindingUserOptions{
+		keepExistingPassword:          d.Get(keepExistingPasswordKey).(bool),
+		sessionTermination:            d.Get(sessionTerminationKey).(string),
+		sessionTerminationGracePeriod: gracePeriod,
+		onDeleteOwnedObjects:          d.Get(onDeleteOwnedObjectsKey).(string),
+		isolation:                     d.Get(isolationKey).(string),
+		access:                        d.Get(accessKey).(string),
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
+}
+
+func sqlUserCreate(ctx context.Context, username, password string, opts bindingUserOptions, m any) diag.Diagnostics {
+	var diags diag.Diagnostics
+	cf := m.(connectionFactory)
+	cf.secrets.add(password)
+
+	audit := newAuditTrail(cf, auditOperationCreate, username)
+	err := runTransaction(ctx, cf, func(tx *sql.Tx) (err error) {
+		if err := acquireBindingLock(ctx, tx, cf); err != nil {
+			return err
+		}
 
-	log.Println("[DEBUG] connected")
-	if err := grantAllPrivilegesToPublicSchema(tx, cf); err != nil {
+		if diags, err = createBindingUser(ctx, audit.wrap(tx), cf, username, password, opts); err != nil {
+			return err
+		}
+		return audit.recordSuccess(ctx, tx)
+	})
+	if err != nil {
+		audit.recordFailure(ctx, err)
 		return diag.FromErr(err)
 	}
 
-	userPresent, err := roleExists(tx, username)
+	return diags
+}
+
+// createBindingUser runs the statements that create a binding user, or adopt an existing role as one
+func createBindingUser(ctx context.Context, tx transaction, cf connectionFactory, username, password string, opts bindingUserOptions) (diag.Diagnostics, error) {
+	var diags diag.Diagnostics
+
+	userPresent, err := roleExists(ctx, tx, username)
 	if err != nil {
-		return diag.Errorf("checking whether binding user exists: %s", err)
+		return nil, fmt.Errorf("checking whether binding user exists: %w", err)
 	}
 
 	if userPresent {
 		// The following instruction ensures admin has access and permissions over any objects created by the legacy user
 		// We need to do this before executing the createDataOwnerRole because there are some instructions in that function
-		// which can fail if there are tables in public schema for which the admin user doesn't have elevated permissions
-		if _, err = tx.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(cf.username))); err != nil {
-			return diag.Errorf("grant admin the right to impersonate legecy role and manipulate its objects: %s", err)
+		// which can fail if there are tables in the schemas for which the admin user doesn't have elevated permissions
+		if err = execStatement(ctx, tx, fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(cf.username))); err != nil {
+			return nil, fmt.Errorf("grant admin the right to impersonate legecy role and manipulate its objects: %w", err)
 		}
 	}
 
-	if err := createDataOwnerRole(tx, cf); err != nil {
-		return diag.FromErr(err)
+	if err := createDataOwnerRole(ctx, tx, cf); err != nil {
+		return nil, err
+	}
+	readerRoleInUse, err := createReaderRole(ctx, tx, cf)
+	if err != nil {
+		return nil, err
+	}
+	if opts.access == accessReadOnly {
+		if err := revokePublicAccess(ctx, tx, cf); err != nil {
+			return nil, err
+		}
 	}
 
-	log.Println("[DEBUG] create binding user")
+	accessRole := cf.accessRole(opts.access)
+
+	tflog.SubsystemDebug(ctx, logSubsystem, "create binding user")
 
 	if userPresent {
 		statements := []string{
-			fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(cf.dataOwnerRole), pq.QuoteIdentifier(username)),
+			fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(accessRole), pq.QuoteIdentifier(username)),
+		}
+		if opts.access == accessReadOnly {
+			statements = append(statements, fmt.Sprintf("REVOKE %s FROM %s", pq.QuoteIdentifier(cf.dataOwnerRole), pq.QuoteIdentifier(username)))
 		}
-		legacyBrokerBindingGroupPresent, err := roleExists(tx, legacyBrokerBindingGroup)
+		legacyBrokerBindingGroupPresent, err := roleExists(ctx, tx, legacyBrokerBindingGroup)
 		if err != nil {
-			return diag.Errorf("checking whether legacy binding group exists: %s", err)
+			return nil, fmt.Errorf("checking whether legacy binding group exists: %w", err)
 		}
 		if legacyBrokerBindingGroupPresent {
 			for _, obj := range []string{"TABLES", "SEQUENCES", "FUNCTIONS"} {
@@ -121,146 +266,471 @@ func sqlUserCreate(ctx context.Context, username, password string, m any) diag.D
 			}
 		}
 		for _, statement := range statements {
-			if _, err := tx.Exec(statement); err != nil {
-				return diag.Errorf("running statement %q: %s", statement, err)
+			if err := execStatement(ctx, tx, statement); err != nil {
+				return nil, fmt.Errorf("running statement %q: %w", statement, err)
+			}
+		}
+
+		passwordDetail := "Its existing password has been kept."
+		if !opts.keepExistingPassword {
+			if err := execStatement(ctx, tx, fmt.Sprintf("ALTER ROLE %s WITH PASSWORD %s", pq.QuoteIdentifier(username), pq.QuoteLiteral(password))); err != nil {
+				return nil, fmt.Errorf("setting password of existing binding role: %w", err)
 			}
+			passwordDetail = "Its password has been set from the configuration."
 		}
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Adopted existing role",
+			Detail:   fmt.Sprintf("Role %q already existed and has been adopted as a binding user. %s", username, passwordDetail),
+		})
 	} else {
-		if _, err := tx.Exec(fmt.Sprintf("CREATE ROLE %s WITH LOGIN PASSWORD %s INHERIT IN ROLE %s", pq.QuoteIdentifier(username), safeQuote(password), pq.QuoteIdentifier(cf.dataOwnerRole))); err != nil {
-			return diag.Errorf("creating binding role: %s", err)
+		if err := execStatement(ctx, tx, fmt.Sprintf("CREATE ROLE %s WITH LOGIN PASSWORD %s INHERIT IN ROLE %s", pq.QuoteIdentifier(username), pq.QuoteLiteral(password), pq.QuoteIdentifier(accessRole))); err != nil {
+			return nil, fmt.Errorf("creating binding role: %w", err)
 		}
-		if _, err = tx.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(cf.username))); err != nil {
-			return diag.Errorf("grant admin the right to impersonate new role and manipulate its objects: %s", err)
+		if err = execStatement(ctx, tx, fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(cf.username))); err != nil {
+			return nil, fmt.Errorf("grant admin the right to impersonate new role and manipulate its objects: %w", err)
 		}
 	}
 
-	if err := grantDefaultPrivilegesOnPublicTablesCreatedBy(tx, username); err != nil {
+	if opts.isolation == isolationSchema {
+		if err := isolateBindingUser(ctx, tx, cf, username); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.access == accessReadOnly {
+		return diags, nil
+	}
+	return diags, grantDefaultPrivilegesOnObjectsCreatedBy(ctx, tx, cf, username, readerRoleInUse)
+}
+
+func resourceBindingUserRead(ctx context.Context, d *schema.ResourceData, m any) diag.Diagnostics {
+	defer traceCall(ctx, "resourceBindingUserRead")()
+
+	username := d.Get(bindingUsernameKey).(string)
+
+	cf := m.(connectionFactory)
+
+	db, err := cf.AdminPool()
+	if err != nil {
+		return diag.Errorf("connecting as admin: %s", err)
+	}
+	tflog.SubsystemDebug(ctx, logSubsystem, "connected")
+
+	state, exists, err := inspectBindingUser(ctx, db, cf, username, d.Get(accessKey).(string))
+	switch {
+	case err != nil:
+		return diag.Errorf("querying for existing role: %s", err)
+	case !exists:
+		d.SetId("")
+		return nil
+	}
+
+	d.SetId(username)
+	if state.drifted() {
+		tflog.SubsystemWarn(ctx, logSubsystem, "binding user has drifted from its setup and will be repaired", map[string]any{
+			accessRoleMemberKey:         state.accessRoleMember,
+			loginEnabledKey:             state.loginEnabled,
+			defaultPrivilegesGrantedKey: state.defaultPrivilegesGranted,
+		})
+	}
+	if d.Get(isolationKey).(string) != isolationSchema {
+		state.isolatedSchema = ""
+	}
+	if err := d.Set(isolatedSchemaKey, state.isolatedSchema); err != nil {
 		return diag.FromErr(err)
 	}
+	for key, value := range map[string]bool{
+		accessRoleMemberKey:         state.accessRoleMember,
+		loginEnabledKey:             state.loginEnabled,
+		defaultPrivilegesGrantedKey: state.defaultPrivilegesGranted,
+	} {
+		if err := d.Set(key, value); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return nil
+}
 
-	if err := tx.Commit(); err != nil {
-		return diag.Errorf("committing transaction: %s", err)
+// resourceBindingUserCustomizeDiff plans an in-place repair when Read has found that
+// a binding user no longer has the setup that sqlUserCreate gave it.
+func resourceBindingUserCustomizeDiff(_ context.Context, d *schema.ResourceDiff, _ any) error {
+	if d.Get(isolationKey).(string) == isolationSchema && d.NewValueKnown(bindingUsernameKey) {
+		if username := d.Get(bindingUsernameKey).(string); d.Get(isolatedSchemaKey).(string) != username {
+			if err := d.SetNew(isolatedSchemaKey, username); err != nil {
+				return err
+			}
+		}
 	}
 
-	log.Printf("[DEBUG] setting ID %s\n", username)
+	if d.Id() == "" {
+		return nil
+	}
 
+	for _, key := range driftKeys {
+		if !d.Get(key).(bool) {
+			if err := d.SetNew(key, true); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-func resourceBindingUserRead(_ context.Context, d *schema.ResourceData, m any) diag.Diagnostics {
-	log.Println("[DEBUG] ENTRY resourceBindingUserRead()")
-	defer log.Println("[DEBUG] EXIT resourceBindingUserRead()")
+func resourceBindingUserUpdate(ctx context.Context, d *schema.ResourceData, m any) diag.Diagnostics {
+	defer traceCall(ctx, "resourceBindingUserUpdate")()
 
 	username := d.Get(bindingUsernameKey).(string)
+	password := d.Get(bindingPasswordKey).(string)
 
+	if d.HasChanges(repairKeys...) {
+		if err := sqlUserRepair(ctx, username, bindingUserOptionsFromResourceData(d), m); err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange(bindingPasswordKey) {
+		if err := sqlUserUpdatePassword(ctx, username, password, m); err != nil {
+			return err
+		}
+	}
+
+	return resourceBindingUserRead(ctx, d, m)
+}
+
+// sqlUserRepair restores the data owner role membership, the LOGIN attribute, the default
+// privileges and the isolated schema of a binding user that have been altered outside of Terraform.
+func sqlUserRepair(ctx context.Context, username string, opts bindingUserOptions, m any) diag.Diagnostics {
 	cf := m.(connectionFactory)
 
-	db, err := cf.ConnectAsAdmin()
+	audit := newAuditTrail(cf, auditOperationRepair, username)
+	err := runTransaction(ctx, cf, func(tx *sql.Tx) error {
+		if err := acquireBindingLock(ctx, tx, cf); err != nil {
+			return err
+		}
+		if err := repairBindingUser(ctx, audit.wrap(tx), cf, username, opts); err != nil {
+			return err
+		}
+		return audit.recordSuccess(ctx, tx)
+	})
 	if err != nil {
-		return diag.Errorf("connecting as admin: %s", err)
+		audit.recordFailure(ctx, err)
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+func repairBindingUser(ctx context.Context, tx transaction, cf connectionFactory, username string, opts bindingUserOptions) error {
+	tflog.SubsystemDebug(ctx, logSubsystem, "repairing binding user")
+	readerRoleInUse, err := createReaderRole(ctx, tx, cf)
+	if err != nil {
+		return err
+	}
+	statements := []string{
+		fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(username), pq.QuoteIdentifier(cf.username)),
+		fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(cf.accessRole(opts.access)), pq.QuoteIdentifier(username)),
+		fmt.Sprintf("ALTER ROLE %s WITH LOGIN", pq.QuoteIdentifier(username)),
+	}
+	for _, statement := range statements {
+		if err := execStatement(ctx, tx, statement); err != nil {
+			return fmt.Errorf("running statement %q: %w", statement, err)
+		}
+	}
+
+	if opts.isolation == isolationSchema {
+		if err := isolateBindingUser(ctx, tx, cf, username); err != nil {
+			return err
+		}
+	}
+
+	if opts.access == accessReadOnly {
+		return nil
+	}
+	return grantDefaultPrivilegesOnObjectsCreatedBy(ctx, tx, cf, username, readerRoleInUse)
+}
+
+// sqlUserUpdatePassword rotates the password of an existing binding user. Ownership, role
+// membership and default privileges are left untouched.
+func sqlUserUpdatePassword(ctx context.Context, username, password string, m any) diag.Diagnostics {
+	cf := m.(connectionFactory)
+	cf.secrets.add(password)
+
+	audit := newAuditTrail(cf, auditOperationUpdatePassword, username)
+	err := runTransaction(ctx, cf, func(tx *sql.Tx) error {
+		if err := updateBindingUserPassword(ctx, audit.wrap(tx), username, password); err != nil {
+			return err
+		}
+		return audit.recordSuccess(ctx, tx)
+	})
+	if err != nil {
+		audit.recordFailure(ctx, err)
+		return diag.FromErr(err)
+	}
+
+	if err := verifyUserCredentials(ctx, username, password, cf); err != nil {
+		return diag.Errorf("verifying updated credentials of binding user %q: %s", username, err)
+	}
+
+	return nil
+}
+
+func updateBindingUserPassword(ctx context.Context, tx transaction, username, password string) error {
+	tflog.SubsystemDebug(ctx, logSubsystem, "updating binding user password")
+	if err := execStatement(ctx, tx, fmt.Sprintf("ALTER ROLE %s WITH PASSWORD %s", pq.QuoteIdentifier(username), pq.QuoteLiteral(password))); err != nil {
+		return fmt.Errorf("updating binding role password: %w", err)
+	}
+	return nil
+}
+
+func verifyUserCredentials(ctx context.Context, username, password string, cf connectionFactory) error {
+	db, err := cf.ConnectAsUser(username, password)
+	if err != nil {
+		return err
 	}
 	defer func() {
 		_ = db.Close()
 	}()
-	log.Println("[DEBUG] connected")
 
-	exists, err := roleExists(db, username)
+	return db.PingContext(ctx)
+}
+
+// resourceBindingUserImport adopts an existing role given an ID of the form <database>/<username>.
+// The password cannot be read back from PostgreSQL, so the next apply will set it from the configuration.
+func resourceBindingUserImport(ctx context.Context, d *schema.ResourceData, m any) ([]*schema.ResourceData, error) {
+	defer traceCall(ctx, "resourceBindingUserImport")()
+
+	database, username, err := parseBindingUserImportID(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	cf := m.(connectionFactory)
+	if database != cf.database {
+		return nil, fmt.Errorf("import ID refers to database %q but the provider is configured for database %q", database, cf.database)
+	}
+
+	db, err := cf.AdminPool()
+	if err != nil {
+		return nil, fmt.Errorf("connecting as admin: %w", err)
+	}
+
+	exists, err := roleExists(ctx, db, username)
 	switch {
 	case err != nil:
-		return diag.Errorf("querying for existing role: %s", err)
-	case exists:
-		d.SetId(username)
-	default:
-		d.SetId("")
+		return nil, fmt.Errorf("querying for existing role: %w", err)
+	case !exists:
+		return nil, fmt.Errorf("role %q does not exist", username)
 	}
 
-	return nil
+	access, err := bindingUserAccess(ctx, db, cf, username)
+	switch {
+	case err != nil:
+		return nil, err
+	case access == "":
+		return nil, fmt.Errorf("role %q is not a member of data owner role %q nor of reader role %q", username, cf.dataOwnerRole, cf.readerRole)
+	}
+
+	// Both force a new resource, so they are read from the catalog rather than planned from their defaults
+	state, _, err := inspectBindingUser(ctx, db, cf, username, access)
+	if err != nil {
+		return nil, fmt.Errorf("inspecting role: %w", err)
+	}
+	isolation := isolationShared
+	if state.isolatedSchema != "" {
+		isolation = isolationSchema
+	}
+
+	d.SetId(username)
+	if err := d.Set(bindingUsernameKey, username); err != nil {
+		return nil, err
+	}
+	if err := d.Set(accessKey, access); err != nil {
+		return nil, err
+	}
+	if err := d.Set(isolationKey, isolation); err != nil {
+		return nil, err
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// bindingUserAccess tells the access of an existing binding user from the role it is a member of.
+// It is empty when the binding user is a member of neither the data owner role nor the reader role.
+func bindingUserAccess(ctx context.Context, q querier, cf connectionFactory, username string) (string, error) {
+	member, err := roleIsMemberOf(ctx, q, username, cf.dataOwnerRole)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("checking data owner role membership: %w", err)
+	case member:
+		return accessReadWrite, nil
+	}
+
+	member, err = roleIsMemberOf(ctx, q, username, cf.readerRole)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("checking reader role membership: %w", err)
+	case member:
+		return accessReadOnly, nil
+	default:
+		return "", nil
+	}
 }
 
-func resourceBindingUserUpdate(_ context.Context, _ *schema.ResourceData, _ any) diag.Diagnostics {
-	log.Println("[DEBUG] ENTRY resourceBindingUserUpdate()")
-	defer log.Println("[DEBUG] EXIT resourceBindingUserUpdate()")
-	return diag.Errorf("update lifecycle not implemented")
+func parseBindingUserImportID(id string) (database, username string, err error) {
+	database, username, found := strings.Cut(id, "/")
+	if !found || database == "" || username == "" {
+		return "", "", fmt.Errorf("invalid import ID %q, expected <database>/<username>", id)
+	}
+	return database, username, nil
 }
 
 func resourceBindingUserDelete(ctx context.Context, d *schema.ResourceData, m any) diag.Diagnostics {
-	log.Println("[DEBUG] ENTRY resourceBindingUserDelete()")
-	defer log.Println("[DEBUG] EXIT resourceBindingUserDelete()")
-
-	deleteBindingMutex.Lock()
-	defer deleteBindingMutex.Unlock()
+	defer traceCall(ctx, "resourceBindingUserDelete")()
 
 	bindingUser := d.Get(bindingUsernameKey).(string)
 	bindingUserPassword := d.Get(bindingPasswordKey).(string)
-	err := sqlUserDelete(ctx, bindingUser, bindingUserPassword, m)
+	err := sqlUserDelete(ctx, bindingUser, bindingUserPassword, bindingUserOptionsFromResourceData(d), m)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func sqlUserDelete(ctx context.Context, bindingUser, bindingUserPassword string, m any) diag.Diagnostics {
+func sqlUserDelete(ctx context.Context, bindingUser, bindingUserPassword string, opts bindingUserOptions, m any) diag.Diagnostics {
 	cf := m.(connectionFactory)
 
-	db, err := cf.ConnectAsAdmin()
+	db, err := cf.AdminPool()
 	if err != nil {
 		return diag.Errorf("connecting as admin: %s", err)
 	}
-	defer func() {
-		_ = db.Close()
-	}()
+	exists, err := roleExists(ctx, db, bindingUser)
+	switch {
+	case err != nil:
+		return diag.FromErr(err)
+	case !exists:
+		return alreadyDeletedDiagnostics(bindingUser)
+	}
 
-	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+	audit := newAuditTrail(cf, auditOperationDelete, bindingUser)
+	if opts.onDeleteOwnedObjects == onDeleteOwnedObjectsFail {
+		err := checkOwnedObjects(ctx, cf, bindingUser, opts)
+		var owned *ownedObjectsError
+		switch {
+		case errors.As(err, &owned):
+			audit.recordFailure(ctx, err)
+			return diag.Diagnostics{owned.diagnostic()}
+		case err != nil:
+			return diag.FromErr(err)
+		}
+	}
+
+	if err := endSessions(ctx, cf, bindingUser, opts); err != nil {
+		return diag.FromErr(err)
+	}
+
+	diags := cleanUpOtherDatabases(ctx, cf, bindingUser, opts)
+	if diags.HasError() {
+		return diags
+	}
+
+	err = runTransaction(ctx, cf, func(tx *sql.Tx) error {
+		if err := acquireBindingLock(ctx, tx, cf); err != nil {
+			return err
+		}
+		if err := deleteBindingUser(ctx, audit.wrap(tx), cf, bindingUser, opts); err != nil {
+			return err
+		}
+		return audit.recordSuccess(ctx, tx)
+	})
 	if err != nil {
-		return diag.Errorf("starting transaction: %s", err)
+		audit.recordFailure(ctx, err)
+		var owned *ownedObjectsError
+		if errors.As(err, &owned) {
+			return append(diags, owned.diagnostic())
+		}
+		return append(diags, diag.FromErr(err)...)
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
 
-	if _, err := tx.ExecContext(ctx, fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(bindingUser), pq.QuoteIdentifier(cf.username))); err != nil {
-		return diag.Errorf("granting admin user access to binding user: %s", err)
+	return diags
+}
+
+// alreadyDeletedDiagnostics reports a binding user that was dropped outside of Terraform, which makes deleting it a
+// no-op. PostgreSQL refuses to drop a role that default privileges still refer to, so there is nothing left to clean up.
+func alreadyDeletedDiagnostics(username string) diag.Diagnostics {
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  "Binding user already deleted",
+		Detail:   fmt.Sprintf("Role %q does not exist, it has probably been dropped outside of Terraform. It has been removed from the state.", username),
+	}}
+}
+
+// deleteBindingUser runs the statements that deal with the objects of a binding user according to its
+// on_delete_owned_objects mode, and drop the binding user
+func deleteBindingUser(ctx context.Context, tx transaction, cf connectionFactory, bindingUser string, opts bindingUserOptions) error {
+	if err := execStatement(ctx, tx, fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(bindingUser), pq.QuoteIdentifier(cf.username))); err != nil {
+		return fmt.Errorf("granting admin user access to binding user: %w", err)
 	}
 
-	log.Println("[DEBUG] dropping binding user")
+	tflog.SubsystemDebug(ctx, logSubsystem, "dropping binding user")
 
-	if err := revokeDefaultPrivilegesOnPublicTablesCreatedBy(tx, bindingUser); err != nil {
-		return diag.FromErr(err)
+	if opts.isolation == isolationSchema && opts.onDeleteOwnedObjects != onDeleteOwnedObjectsDrop {
+		if err := releaseIsolatedSchema(ctx, tx, cf, bindingUser); err != nil {
+			return err
+		}
 	}
 
-	statements := []string{
-		fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(bindingUser)),
-		fmt.Sprintf("REASSIGN OWNED BY CURRENT_USER TO %s", pq.QuoteIdentifier(cf.dataOwnerRole)),
-		fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(cf.username)),
+	var statements []string
+	switch opts.onDeleteOwnedObjects {
+	case onDeleteOwnedObjectsFail:
+		objects, err := listOwnedObjects(ctx, tx, bindingUser, "")
+		if err != nil {
+			return err
+		}
+		if len(objects) > 0 {
+			return &ownedObjectsError{username: bindingUser, objects: objects}
+		}
+	case onDeleteOwnedObjectsDrop:
+		statements = append(statements,
+			fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(bindingUser)),
+			"DROP OWNED BY CURRENT_USER",
+			fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(cf.username)),
+		)
+	default:
+		statements = append(statements,
+			fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(bindingUser)),
+			fmt.Sprintf("REASSIGN OWNED BY CURRENT_USER TO %s", pq.QuoteIdentifier(cf.dataOwnerRole)),
+			fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(cf.username)),
+		)
+	}
+	if opts.onDeleteOwnedObjects != onDeleteOwnedObjectsDrop {
+		// Once the objects have been reassigned, only the privileges are left to drop, including the default
+		// privileges of the binding user, whatever their grantees and schemas
+		statements = append(statements, fmt.Sprintf("DROP OWNED BY %s", pq.QuoteIdentifier(bindingUser)))
+	}
+
+	statements = append(statements,
 		fmt.Sprintf("REVOKE ALL PRIVILEGES ON DATABASE %s FROM %s CASCADE;", pq.QuoteIdentifier(cf.database), pq.QuoteIdentifier(bindingUser)),
 		fmt.Sprintf("DROP ROLE %s", pq.QuoteIdentifier(bindingUser)),
-	}
+	)
 	for _, statement := range statements {
-		if _, err = tx.Exec(statement); err != nil {
-			return diag.Errorf("running statement %q: %s", statement, err)
+		if err := execStatement(ctx, tx, statement); err != nil {
+			return fmt.Errorf("running statement %q: %w", statement, err)
 		}
 	}
 
-	if err = tx.Commit(); err != nil {
-		return diag.Errorf("committing transaction: %s", err)
-	}
-
 	return nil
 }
 
-func safeQuote(s string) string {
-	return fmt.Sprintf("'%s'", strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `'`, `\\`))
-}
-
 type querier interface {
-	Query(query string, args ...any) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 }
 
-func roleExists(q querier, name string) (bool, error) {
-	log.Println("[DEBUG] ENTRY roleExists()")
-	defer log.Println("[DEBUG] EXIT roleExists()")
+func roleExists(ctx context.Context, q querier, name string) (bool, error) {
+	defer traceCall(ctx, "roleExists")()
 
-	rows, err := q.Query(fmt.Sprintf("SELECT FROM pg_catalog.pg_roles WHERE rolname = '%s'", name))
+	rows, err := q.QueryContext(ctx, "SELECT FROM pg_catalog.pg_roles WHERE rolname = $1", name)
 	if err != nil {
 		return false, fmt.Errorf("error finding role %q: %w", name, err)
 	}
@@ -271,16 +741,47 @@ func roleExists(q querier, name string) (bool, error) {
 	return rows.Next(), nil
 }
 
-func grantDefaultPrivilegesOnPublicTablesCreatedBy(tx *sql.Tx, username string) error {
-	if _, err := tx.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA PUBLIC GRANT ALL ON TABLES TO PUBLIC", pq.QuoteIdentifier(username))); err != nil {
-		return fmt.Errorf("failed to grant default privileges on public tables created by %q: %s", username, err)
+func roleIsMemberOf(ctx context.Context, q querier, name, group string) (bool, error) {
+	defer traceCall(ctx, "roleIsMemberOf")()
+
+	var member bool
+	rows, err := q.QueryContext(ctx, "SELECT pg_has_role($1, oid, 'MEMBER') FROM pg_catalog.pg_roles WHERE rolname = $2", name, group)
+	if err != nil {
+		return false, fmt.Errorf("error checking membership of role %q in %q: %w", name, group, err)
 	}
-	return nil
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	if err := rows.Scan(&member); err != nil {
+		return false, fmt.Errorf("error checking membership of role %q in %q: %w", name, group, err)
+	}
+	return member, nil
 }
 
-func revokeDefaultPrivilegesOnPublicTablesCreatedBy(tx *sql.Tx, username string) error {
-	if _, err := tx.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA PUBLIC REVOKE ALL ON TABLES FROM PUBLIC", pq.QuoteIdentifier(username))); err != nil {
-		return fmt.Errorf("failed to revoke default privileges on public tables created by %q: %s", username, err)
+// grantDefaultPrivilegesOnObjectsCreatedBy lets the data owner role use, and the reader role read when it is in use,
+// the tables, sequences, functions and types that a read-write binding user creates in the schemas
+func grantDefaultPrivilegesOnObjectsCreatedBy(ctx context.Context, tx transaction, cf connectionFactory, username string, readerRoleInUse bool) error {
+	schemas := quoteIdentifiers(cf.schemas)
+	var statements []string
+	for _, objects := range []string{"TABLES", "SEQUENCES", "FUNCTIONS", "TYPES"} {
+		statements = append(statements, fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT ALL ON %s TO %s", pq.QuoteIdentifier(username), schemas, objects, pq.QuoteIdentifier(cf.dataOwnerRole)))
+	}
+	if readerRoleInUse {
+		for _, objects := range []string{"TABLES", "SEQUENCES"} {
+			statements = append(statements, fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT SELECT ON %s TO %s", pq.QuoteIdentifier(username), schemas, objects, pq.QuoteIdentifier(cf.readerRole)))
+		}
+	}
+	if !cf.revokePublicAccess {
+		statements = append(statements, fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT ALL ON TABLES TO PUBLIC", pq.QuoteIdentifier(username), schemas))
+	}
+	for _, statement := range statements {
+		if err := execStatement(ctx, tx, statement); err != nil {
+			return fmt.Errorf("failed to grant default privileges on objects created by %q: %w", username, err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,112 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/lib/pq"
+	"github.com/lib/pq/pqerror"
+)
+
+const (
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// runTransaction connects as admin and runs fn inside a transaction. When the transaction fails with a transient
+// error, the whole of it is run again with a jittered exponential backoff, up to the configured number of retries
+// or until the context is done. fn must therefore be safe to run more than once.
+func runTransaction(ctx context.Context, cf connectionFactory, fn func(tx *sql.Tx) error) error {
+	for attempt := 0; ; attempt++ {
+		err := runTransactionOnce(ctx, cf, fn)
+		if err == nil || attempt >= cf.maxRetries || !isTransientError(err) {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		tflog.SubsystemWarn(ctx, logSubsystem, "transaction failed with a transient error, retrying", map[string]any{
+			"attempt":     attempt + 1,
+			"max_retries": cf.maxRetries,
+			"delay":       delay.String(),
+			logFieldError: cf.secrets.redact(err.Error()),
+		})
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up retrying: %w)", err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+func runTransactionOnce(ctx context.Context, cf connectionFactory, fn func(tx *sql.Tx) error) error {
+	db, err := cf.AdminPool()
+	if err != nil {
+		return fmt.Errorf("connecting as admin: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := setTransactionTimeouts(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// isTransientError reports whether running the same transaction again could succeed
+func isTransientError(err error) bool {
+	if pqErr := pq.As(err); pqErr != nil {
+		switch pqErr.Code {
+		case pqerror.TRSerializationFailure, pqerror.TRDeadlockDetected, pqerror.AdminShutdown, pqerror.CannotConnectNow:
+			return true
+		case pqerror.InternalError:
+			return strings.Contains(pqErr.Message, "tuple concurrently updated")
+		case pqerror.UniqueViolation:
+			// Concurrent CREATE ... IF NOT EXISTS, such as that of the audit table by operations that do not hold
+			// the binding lock, can race on the unique indexes of the system catalogs
+			return strings.HasPrefix(pqErr.Constraint, "pg_")
+		default:
+			return false
+		}
+	}
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retryDelay returns a random delay between half and all of retryBaseDelay * 2^attempt, capped at retryMaxDelay
+func retryDelay(attempt int) time.Duration {
+	ceiling := retryMaxDelay
+	if attempt < 16 {
+		ceiling = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	return ceiling/2 + rand.N(ceiling/2)
+}
@@ -0,0 +1,49 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/lib/pq"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("isTransientError", func() {
+	DescribeTable("classifies errors",
+		func(err error, expected bool) {
+			Expect(isTransientError(fmt.Errorf("running statement: %w", err))).To(Equal(expected))
+		},
+		Entry("serialization failure", &pq.Error{Code: "40001"}, true),
+		Entry("deadlock", &pq.Error{Code: "40P01"}, true),
+		Entry("concurrent catalog update", &pq.Error{Code: "XX000", Message: "tuple concurrently updated"}, true),
+		Entry("other internal error", &pq.Error{Code: "XX000", Message: "cache lookup failed for relation 1234"}, false),
+		Entry("concurrent catalog insert", &pq.Error{Code: "23505", Constraint: "pg_type_typname_nsp_index"}, true),
+		Entry("unique violation in a table", &pq.Error{Code: "23505", Constraint: "csbpg_audit_log_pkey"}, false),
+		Entry("admin shutdown", &pq.Error{Code: "57P01"}, true),
+		Entry("server starting up", &pq.Error{Code: "57P03"}, true),
+		Entry("insufficient privilege", &pq.Error{Code: "42501"}, false),
+		Entry("lock timeout", &pq.Error{Code: "55P03"}, false),
+		Entry("bad connection", driver.ErrBadConn, true),
+		Entry("unexpected EOF", io.ErrUnexpectedEOF, true),
+		Entry("connection reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true),
+		Entry("broken pipe", &net.OpError{Op: "write", Err: syscall.EPIPE}, true),
+		Entry("context deadline", context.DeadlineExceeded, false),
+		Entry("arbitrary error", errors.New("boom"), false),
+	)
+})
+
+var _ = Describe("retryDelay", func() {
+	It("grows exponentially with jitter and is capped", func() {
+		for range 100 {
+			Expect(retryDelay(0)).To(BeNumerically("~", retryBaseDelay*3/4, retryBaseDelay/4))
+			Expect(retryDelay(2)).To(BeNumerically("~", retryBaseDelay*3, retryBaseDelay))
+			Expect(retryDelay(30)).To(BeNumerically("~", retryMaxDelay*3/4, retryMaxDelay/4))
+		}
+	})
+})
@@ -0,0 +1,64 @@
+package csbpg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/lib/pq"
+)
+
+// defaultSchema is the schema that bindings use when the provider has no schemas configured
+const defaultSchema = "public"
+
+// grantAllPrivilegesToSchemas creates the schemas of the provider that are missing, makes the admin user their owner
+// and lets the binding users use them
+func grantAllPrivilegesToSchemas(ctx context.Context, tx transaction, cf connectionFactory) error {
+	for _, schema := range cf.schemas {
+		exists, err := schemaExists(ctx, tx, schema)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			tflog.SubsystemDebug(ctx, logSubsystem, "schema does not exist - creating", map[string]any{"schema": schema})
+			if err := execStatement(ctx, tx, fmt.Sprintf("CREATE SCHEMA %s", pq.QuoteIdentifier(schema))); err != nil {
+				return fmt.Errorf("creating schema %s: %w", schema, err)
+			}
+		}
+
+		tflog.SubsystemDebug(ctx, logSubsystem, "make admin user owner of the schema", map[string]any{"schema": schema})
+		if err := execStatement(ctx, tx, fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s", pq.QuoteIdentifier(schema), pq.QuoteIdentifier(cf.username))); err != nil {
+			return fmt.Errorf("make schema %s be owned by admin user: %w", schema, err)
+		}
+		tflog.SubsystemDebug(ctx, logSubsystem, "granting permission on schema (required since postgres 15)", map[string]any{"schema": schema, "grantee": cf.sharedGrantee()})
+		if err := execStatement(ctx, tx, fmt.Sprintf("GRANT ALL ON SCHEMA %s TO %s", pq.QuoteIdentifier(schema), cf.sharedGrantee())); err != nil {
+			return fmt.Errorf("granting all privileges on schema %s to %s: %w", schema, cf.sharedGrantee(), err)
+		}
+	}
+
+	return nil
+}
+
+func schemaExists(ctx context.Context, q querier, schema string) (bool, error) {
+	defer traceCall(ctx, "schemaExists")()
+
+	rows, err := q.QueryContext(ctx, "SELECT FROM pg_catalog.pg_namespace WHERE nspname = $1", schema)
+	if err != nil {
+		return false, fmt.Errorf("error finding schema %q: %w", schema, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	return rows.Next(), rows.Err()
+}
+
+// quoteIdentifiers quotes names for a statement that takes a comma-separated list of identifiers
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pq.QuoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,106 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/lib/pq"
+)
+
+const (
+	sessionTerminationNone      = "none"
+	sessionTerminationWait      = "wait"
+	sessionTerminationTerminate = "terminate"
+
+	sessionPollInterval = time.Second
+
+	// terminatedSessionsTimeout is how long terminated sessions are given to go away
+	terminatedSessionsTimeout = 10 * time.Second
+)
+
+// endSessions prepares a binding user for deletion according to its session termination policy. LOGIN is revoked in
+// a transaction of its own, so that no new session can start, then the open sessions are given the grace period to
+// end. With the wait policy, sessions still open after that make the deletion fail. With the terminate policy, they
+// are terminated.
+func endSessions(ctx context.Context, cf connectionFactory, username string, opts bindingUserOptions) error {
+	switch opts.sessionTermination {
+	case sessionTerminationWait, sessionTerminationTerminate:
+	default:
+		return nil
+	}
+
+	audit := newAuditTrail(cf, auditOperationRevokeLogin, username)
+	err := runTransaction(ctx, cf, func(tx *sql.Tx) error {
+		if err := revokeLogin(ctx, audit.wrap(tx), username); err != nil {
+			return err
+		}
+		return audit.recordSuccess(ctx, tx)
+	})
+	if err != nil {
+		audit.recordFailure(ctx, err)
+		return err
+	}
+
+	db, err := cf.AdminPool()
+	if err != nil {
+		return fmt.Errorf("connecting as admin: %w", err)
+	}
+
+	sessions, err := waitForSessionsToEnd(ctx, db, username, opts.sessionTerminationGracePeriod)
+	switch {
+	case err != nil:
+		return err
+	case sessions == 0:
+		return nil
+	case opts.sessionTermination == sessionTerminationWait:
+		return fmt.Errorf("binding user %q still has %d open sessions after waiting %s for them to end", username, sessions, opts.sessionTerminationGracePeriod)
+	}
+
+	tflog.SubsystemInfo(ctx, logSubsystem, "terminating sessions of binding user", map[string]any{"sessions": sessions})
+	if _, err := db.ExecContext(ctx, "SELECT pg_catalog.pg_terminate_backend(pid) FROM pg_catalog.pg_stat_activity WHERE usename = $1 AND pid <> pg_catalog.pg_backend_pid()", username); err != nil {
+		return fmt.Errorf("terminating sessions of binding user %q: %w", username, err)
+	}
+
+	sessions, err = waitForSessionsToEnd(ctx, db, username, terminatedSessionsTimeout)
+	switch {
+	case err != nil:
+		return err
+	case sessions > 0:
+		return fmt.Errorf("binding user %q still has %d open sessions after terminating them", username, sessions)
+	}
+	return nil
+}
+
+func revokeLogin(ctx context.Context, tx transaction, username string) error {
+	if err := execStatement(ctx, tx, fmt.Sprintf("ALTER ROLE %s WITH NOLOGIN", pq.QuoteIdentifier(username))); err != nil {
+		return fmt.Errorf("revoking login from binding user: %w", err)
+	}
+	return nil
+}
+
+// waitForSessionsToEnd polls the sessions of a role until there are none left or the timeout expires, and returns
+// how many are still open
+func waitForSessionsToEnd(ctx context.Context, db *sql.DB, username string, timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var sessions int
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM pg_catalog.pg_stat_activity WHERE usename = $1 AND pid <> pg_catalog.pg_backend_pid()", username).Scan(&sessions); err != nil {
+			return 0, fmt.Errorf("counting sessions of binding user %q: %w", username, err)
+		}
+
+		remaining := time.Until(deadline)
+		if sessions == 0 || remaining <= 0 {
+			return sessions, nil
+		}
+
+		tflog.SubsystemDebug(ctx, logSubsystem, "waiting for sessions of binding user to end", map[string]any{"sessions": sessions})
+		select {
+		case <-ctx.Done():
+			return sessions, fmt.Errorf("waiting for %d sessions of binding user %q to end: %w", sessions, username, ctx.Err())
+		case <-time.After(min(sessionPollInterval, remaining)):
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package csbpg
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceBindingUserV0 is the schema of csbpg_binding_user before any attribute had a default
+func resourceBindingUserV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			bindingUsernameKey: {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			bindingPasswordKey: {
+				Type:      schema.TypeString,
+				Required:  true,
+				Sensitive: true,
+			},
+		},
+	}
+}
+
+// upgradeBindingUserStateV0 fills in the attributes that have been added with a default since version 0. Without them,
+// a plan that does not refresh the state first would compare them with their defaults, and the ones that force a new
+// resource would replace every existing binding user.
+func upgradeBindingUserStateV0(_ context.Context, rawState map[string]any, _ any) (map[string]any, error) {
+	if rawState == nil {
+		rawState = map[string]any{}
+	}
+	for key, attribute := range resourceBindingUser().Schema {
+		if _, ok := rawState[key]; !ok && attribute.Default != nil {
+			rawState[key] = attribute.Default
+		}
+	}
+	return rawState, nil
+}
@@ -0,0 +1,60 @@
+package csbpg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("binding user state upgrade", func() {
+	It("fills in the attributes added with a default since version 0", func() {
+		upgraded, err := upgradeBindingUserStateV0(context.TODO(), map[string]any{
+			"id":               "someuser",
+			bindingUsernameKey: "someuser",
+			bindingPasswordKey: "secret",
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgraded).To(Equal(map[string]any{
+			"id":                             "someuser",
+			bindingUsernameKey:               "someuser",
+			bindingPasswordKey:               "secret",
+			keepExistingPasswordKey:          false,
+			sessionTerminationKey:            sessionTerminationNone,
+			sessionTerminationGracePeriodKey: "30s",
+			onDeleteOwnedObjectsKey:          onDeleteOwnedObjectsReassign,
+			accessKey:                        accessReadWrite,
+			isolationKey:                     isolationShared,
+		}))
+	})
+
+	It("keeps the attributes that are already set", func() {
+		upgraded, err := upgradeBindingUserStateV0(context.TODO(), map[string]any{
+			bindingUsernameKey: "someuser",
+			isolationKey:       isolationSchema,
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgraded).To(HaveKeyWithValue(isolationKey, isolationSchema))
+	})
+
+	It("does not plan the replacement of upgraded binding users", func() {
+		upgraded, err := upgradeBindingUserStateV0(context.TODO(), map[string]any{
+			"id":               "someuser",
+			bindingUsernameKey: "someuser",
+			bindingPasswordKey: "secret",
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		attributes := map[string]string{}
+		for key, value := range upgraded {
+			attributes[key] = fmt.Sprint(value)
+		}
+		state := &terraform.InstanceState{ID: "someuser", Attributes: attributes}
+		config := terraform.NewResourceConfigRaw(map[string]any{bindingUsernameKey: "someuser", bindingPasswordKey: "secret"})
+		diff, err := resourceBindingUser().Diff(context.TODO(), state, config, connectionFactory{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.RequiresNew()).To(BeFalse())
+	})
+})
@@ -0,0 +1,47 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/lib/pq"
+	"github.com/lib/pq/pqerror"
+)
+
+// transaction is the part of *sql.Tx that binding operations use. previewTransaction implements it to record the
+// statements of an operation instead of running them.
+type transaction interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// execStatement runs a statement with the context of the current operation. When the statement is interrupted
+// by one of the timeouts set by setTransactionTimeouts, the error says which statement was blocked and why.
+func execStatement(ctx context.Context, tx transaction, statement string, args ...any) error {
+	start := time.Now()
+	_, err := tx.ExecContext(ctx, statement, args...)
+	fields := map[string]any{
+		logFieldStatement: statement,
+		logFieldDuration:  time.Since(start).String(),
+	}
+	if err != nil {
+		fields[logFieldError] = err.Error()
+	}
+	tflog.SubsystemDebug(ctx, logSubsystem, "executed statement", fields)
+
+	if err != nil {
+		switch {
+		case pq.As(err, pqerror.LockNotAvailable) != nil:
+			return fmt.Errorf("statement %q timed out waiting for a lock held by another session, check pg_stat_activity for blocking sessions or increase the resource timeout: %w", statement, err)
+		case pq.As(err, pqerror.QueryCanceled) != nil:
+			return fmt.Errorf("statement %q was cancelled because the operation exceeded its timeout: %w", statement, err)
+		default:
+			return err
+		}
+	}
+	return nil
+}
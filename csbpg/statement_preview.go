@@ -0,0 +1,140 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	plannedStatementsKey = "planned_statements"
+
+	statementPreviewTimeout = 30 * time.Second
+)
+
+// previewTransaction records the statements of a binding operation instead of running them. Catalog queries are
+// run by the read-only transaction it wraps, so the operation takes the same branches as it would when applied.
+type previewTransaction struct {
+	*sql.Tx
+	statements []string
+}
+
+func (p *previewTransaction) ExecContext(_ context.Context, query string, _ ...any) (sql.Result, error) {
+	p.statements = append(p.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+// previewStatements returns the statements that fn would run, with every known secret masked
+func previewStatements(ctx context.Context, cf connectionFactory, fn func(tx transaction) error) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, statementPreviewTimeout)
+	defer cancel()
+
+	db, err := cf.AdminPool()
+	if err != nil {
+		return nil, fmt.Errorf("connecting as admin: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("starting read-only transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := setTransactionTimeouts(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	preview := &previewTransaction{Tx: tx}
+	if err := fn(preview); err != nil {
+		return nil, err
+	}
+
+	statements := make([]string, 0, len(preview.statements))
+	for _, statement := range preview.statements {
+		statements = append(statements, cf.secrets.redact(statement))
+	}
+	return statements, nil
+}
+
+// resourceBindingUserPlanStatements fills planned_statements with the statements that applying the plan would run,
+// when the provider is configured to preview them. Passwords are replaced by a placeholder.
+func resourceBindingUserPlanStatements(ctx context.Context, d *schema.ResourceDiff, m any) error {
+	cf, ok := m.(connectionFactory)
+	if !ok || !cf.previewStatements {
+		return nil
+	}
+
+	if d.Id() != "" {
+		// A new username replaces the binding user, and CustomizeDiff runs again as if the resource was new
+		if d.HasChange(bindingUsernameKey) || !d.HasChanges(append([]string{bindingPasswordKey}, repairKeys...)...) {
+			return nil
+		}
+	}
+
+	if !d.NewValueKnown(bindingUsernameKey) {
+		return d.SetNewComputed(plannedStatementsKey)
+	}
+
+	username := d.Get(bindingUsernameKey).(string)
+	replacedUsername := priorValue(d, bindingUsernameKey)
+	opts := bindingUserOptionsFromResourceData(d)
+
+	statements, err := previewStatements(ctx, cf, func(tx transaction) error {
+		if d.Id() != "" {
+			if d.HasChanges(repairKeys...) {
+				if err := repairBindingUser(ctx, tx, cf, username, opts); err != nil {
+					return err
+				}
+			}
+			if d.HasChange(bindingPasswordKey) {
+				return updateBindingUserPassword(ctx, tx, username, redacted)
+			}
+			return nil
+		}
+
+		if replacedUsername != "" {
+			switch priorValue(d, sessionTerminationKey) {
+			case sessionTerminationWait, sessionTerminationTerminate:
+				if err := revokeLogin(ctx, tx, replacedUsername); err != nil {
+					return err
+				}
+			}
+			replacedOpts := bindingUserOptions{
+				onDeleteOwnedObjects: priorValue(d, onDeleteOwnedObjectsKey),
+				isolation:            priorValue(d, isolationKey),
+			}
+			if err := deleteBindingUser(ctx, tx, cf, replacedUsername, replacedOpts); err != nil {
+				return err
+			}
+		}
+		_, err := createBindingUser(ctx, tx, cf, username, redacted, opts)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("previewing the statements of binding user %q: %w", username, err)
+	}
+
+	return d.SetNew(plannedStatementsKey, statements)
+}
+
+// priorValue returns a string attribute of the binding user being replaced, or "" if there is none. When a resource
+// is replaced, the prior state is only available as the raw state.
+func priorValue(d *schema.ResourceDiff, key string) string {
+	state := d.GetRawState()
+	if state.IsNull() || !state.IsKnown() || !state.Type().IsObjectType() || !state.Type().HasAttribute(key) {
+		return ""
+	}
+
+	value := state.GetAttr(key)
+	if value.IsNull() || !value.IsKnown() || !value.Type().Equals(cty.String) {
+		return ""
+	}
+	return value.AsString()
+}
@@ -0,0 +1,60 @@
+package csbpg
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("statement preview", func() {
+	config := terraform.NewResourceConfigRaw(map[string]any{
+		bindingUsernameKey: "someuser",
+		bindingPasswordKey: "somepassword",
+	})
+
+	It("does not plan statements unless the provider is configured to", func() {
+		diff, err := resourceBindingUser().Diff(context.TODO(), nil, config, connectionFactory{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.Attributes).To(HaveKeyWithValue(plannedStatementsKey+".#", HaveField("NewComputed", BeTrue())))
+	})
+
+	It("finds the username of a replaced binding user in the prior state", func() {
+		state := &terraform.InstanceState{
+			ID:         "olduser",
+			Attributes: map[string]string{bindingUsernameKey: "olduser", bindingPasswordKey: "somepassword"},
+			RawState: cty.ObjectVal(map[string]cty.Value{
+				bindingUsernameKey: cty.StringVal("olduser"),
+				bindingPasswordKey: cty.StringVal("somepassword"),
+			}),
+		}
+
+		var usernames []string
+		r := resourceBindingUser()
+		r.CustomizeDiff = func(_ context.Context, d *schema.ResourceDiff, _ any) error {
+			usernames = append(usernames, priorValue(d, bindingUsernameKey))
+			return nil
+		}
+
+		diff, err := r.Diff(context.TODO(), state, config, connectionFactory{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(diff.RequiresNew()).To(BeTrue())
+		Expect(usernames).To(Equal([]string{"olduser", "olduser"}))
+	})
+
+	It("finds no prior username when creating binding users", func() {
+		var usernames []string
+		r := resourceBindingUser()
+		r.CustomizeDiff = func(_ context.Context, d *schema.ResourceDiff, _ any) error {
+			usernames = append(usernames, priorValue(d, bindingUsernameKey))
+			return nil
+		}
+
+		_, err := r.Diff(context.TODO(), nil, config, connectionFactory{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usernames).To(HaveEach(BeEmpty()))
+	})
+})
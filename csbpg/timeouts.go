@@ -0,0 +1,40 @@
+package csbpg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// setTransactionTimeouts sets statement_timeout for the rest of the transaction to the time left before the
+// context deadline, so that the server gives up on a blocked statement even when the client cannot cancel it.
+// lock_timeout is set slightly shorter so that a statement stuck behind another session's lock is reported as
+// such rather than as a generic cancellation. Without a deadline the server settings are left unchanged.
+func setTransactionTimeouts(ctx context.Context, tx *sql.Tx) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining <= 0 {
+		return context.DeadlineExceeded
+	}
+
+	settings := map[string]int64{
+		"statement_timeout": remaining,
+		"lock_timeout":      deadlineLockTimeout(time.Until(deadline)).Milliseconds(),
+	}
+	for setting, value := range settings {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL %s = %d", setting, value)); err != nil {
+			return fmt.Errorf("setting %s: %w", setting, err)
+		}
+	}
+	return nil
+}
+
+// deadlineLockTimeout is the lock_timeout that leaves time before the deadline to report a lock wait as such
+func deadlineLockTimeout(remaining time.Duration) time.Duration {
+	return max(remaining*9/10, time.Millisecond)
+}
@@ -5,7 +5,11 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 )
 
+// version is set by goreleaser
+var version = "dev"
+
 func main() {
+	csbpg.Version = version
 	plugin.Serve(&plugin.ServeOpts{
 		ProviderFunc: csbpg.Provider,
 	})
@@ -338,6 +338,160 @@ EOF
 			return nil
 		})
 	})
+	It("sets the configured password when re-attaching an existing legacy user", func() {
+		dataOwnerRole := "dataOwnerRole_" + uuid.New().String()
+		bindingUsername := "bindingUsername_" + uuid.New().String()
+		legacyPassword := uuid.New().String()
+		bindingPassword := uuid.New().String()
+
+		By("CREATING PRE-EXISTING USER WITH A DIFFERENT PASSWORD")
+		db, err := sql.Open("postgres", adminUserURI)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		_, err = db.Exec(fmt.Sprintf("CREATE USER %s WITH PASSWORD %s", pq.QuoteIdentifier(bindingUsername), pq.QuoteLiteral(legacyPassword)))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = db.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(bindingUsername), pq.QuoteIdentifier(cloudsqlsuperuser)))
+		Expect(err).NotTo(HaveOccurred())
+
+		applyHCL(fmt.Sprintf(`
+		provider "csbpg" {
+		  host            = "%s"
+		  port            = %d
+		  username        = "%s"
+		  password        = "%s"
+		  database        = "%s"
+		  data_owner_role = "%s"
+
+		  sslrootcert = <<EOF
+%s
+EOF
+		  clientcert {
+    		cert = <<EOF
+%s
+EOF
+    		key  = <<EOF
+%s
+EOF
+  	      }
+		}
+
+		resource "csbpg_binding_user" "binding_user" {
+		  username = "%s"
+		  password = "%s"
+		}
+		`, hostname, port, adminUsername, adminPassword, database, dataOwnerRole,
+			postgresSSLCACert, postgresSSLClientCert, postgresSSLClientKey,
+			bindingUsername, bindingPassword),
+			func(state *terraform.State) error {
+				By("checking that the configured password works")
+				bindingDB, err := sql.Open("postgres", buildConnectionString(bindingUsername, bindingPassword, port, database))
+				Expect(err).NotTo(HaveOccurred())
+				defer bindingDB.Close()
+				Expect(bindingDB.Ping()).To(Succeed())
+
+				By("checking that the legacy password no longer works")
+				legacyDB, err := sql.Open("postgres", buildConnectionString(bindingUsername, legacyPassword, port, database))
+				Expect(err).NotTo(HaveOccurred())
+				defer legacyDB.Close()
+				Expect(legacyDB.Ping()).To(MatchError(ContainSubstring("password authentication failed")))
+				return nil
+			},
+			func(state *terraform.State) error { return nil })
+	})
+
+	It("rotates the password of a binding user in place", func() {
+		dataOwnerRole := "dataOwnerRole_" + uuid.New().String()
+		bindingUsername := "bindingUsername_" + uuid.New().String()
+		initialPassword := uuid.New().String()
+		rotatedPassword := uuid.New().String()
+		var bindingUserOID int
+
+		config := func(password string) string {
+			return fmt.Sprintf(`
+		provider "csbpg" {
+		  host            = "%s"
+		  port            = %d
+		  username        = "%s"
+		  password        = "%s"
+		  database        = "%s"
+		  data_owner_role = "%s"
+
+		  sslrootcert = <<EOF
+%s
+EOF
+		  clientcert {
+    		cert = <<EOF
+%s
+EOF
+    		key  = <<EOF
+%s
+EOF
+  	      }
+		}
+
+		resource "csbpg_binding_user" "binding_user" {
+		  username = "%s"
+		  password = "%s"
+		}
+		`, hostname, port, adminUsername, adminPassword, database, dataOwnerRole,
+				postgresSSLCACert, postgresSSLClientCert, postgresSSLClientKey,
+				bindingUsername, password)
+		}
+
+		resource.Test(GinkgoT(), resource.TestCase{
+			IsUnitTest: true,
+			ProviderFactories: map[string]func() (*schema.Provider, error){
+				"csbpg": func() (*schema.Provider, error) { return csbpg.Provider(), nil },
+			},
+			Steps: []resource.TestStep{
+				{
+					Config: config(initialPassword),
+					Check: func(state *terraform.State) error {
+						By("CHECKING RESOURCE CREATE")
+						db, err := sql.Open("postgres", adminUserURI)
+						Expect(err).NotTo(HaveOccurred())
+						defer db.Close()
+
+						Expect(db.QueryRow("SELECT oid FROM pg_catalog.pg_roles WHERE rolname = $1", bindingUsername).Scan(&bindingUserOID)).To(Succeed())
+
+						bindingDB, err := sql.Open("postgres", buildConnectionString(bindingUsername, initialPassword, port, database))
+						Expect(err).NotTo(HaveOccurred())
+						defer bindingDB.Close()
+						_, err = bindingDB.Exec("CREATE TABLE rotation(PK INT primary key)")
+						Expect(err).NotTo(HaveOccurred())
+						return nil
+					},
+				},
+				{
+					Config: config(rotatedPassword),
+					Check: func(state *terraform.State) error {
+						By("CHECKING RESOURCE UPDATE")
+						db, err := sql.Open("postgres", adminUserURI)
+						Expect(err).NotTo(HaveOccurred())
+						defer db.Close()
+
+						By("checking that the binding user has not been recreated")
+						var oid int
+						Expect(db.QueryRow("SELECT oid FROM pg_catalog.pg_roles WHERE rolname = $1", bindingUsername).Scan(&oid)).To(Succeed())
+						Expect(oid).To(Equal(bindingUserOID))
+
+						By("checking that the previous password no longer works")
+						oldDB, err := sql.Open("postgres", buildConnectionString(bindingUsername, initialPassword, port, database))
+						Expect(err).NotTo(HaveOccurred())
+						defer oldDB.Close()
+						Expect(oldDB.Ping()).To(MatchError(ContainSubstring("password authentication failed")))
+
+						By("checking that the new password can access existing data")
+						newDB, err := sql.Open("postgres", buildConnectionString(bindingUsername, rotatedPassword, port, database))
+						Expect(err).NotTo(HaveOccurred())
+						defer newDB.Close()
+						Expect(query(newDB, "SELECT COUNT(*) FROM rotation")).To(ConsistOf(BeEquivalentTo(0)))
+						return nil
+					},
+				},
+			},
+		})
+	})
 })
 
 func buildConnectionString(username, password string, port int, database string) string {